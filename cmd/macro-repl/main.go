@@ -0,0 +1,388 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Command macro-repl reads S-expressions interactively and prints them back
+// pretty-printed, optionally after expanding macros and evaluating them.
+//
+// Usage:
+//
+//	macro-repl [-expand] [-eval] [-width n] [-history file] [file ...]
+//
+// An entry continues over several lines until its delimiters balance. With
+// -expand, syntax-rules macros defined with define-syntax are expanded, and
+// with -eval each form is evaluated and its value printed. Evaluation is
+// limited in steps and depth, and an interrupt (Ctrl-C) abandons it and
+// returns to the prompt. Macros and definitions persist for the rest of the
+// session. The files given are loaded before the first prompt.
+//
+// Lines starting with a colon are commands:
+//
+//	:load file   read, expand and evaluate the forms of a file
+//	:history     list the entries read so far
+//	:help        list the commands
+//	:quit        exit, as does end of input
+//
+// Entries are appended to the history file, which :history lists along with
+// entries from earlier sessions.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/eval"
+	"github.com/mowen132/macro/expand"
+)
+
+type repl struct {
+	expand    bool
+	eval      bool
+	width     int
+	expander  *expand.Expander
+	evaluator *eval.Evaluator
+	history   []string
+	file      *os.File
+	out       io.Writer
+}
+
+func main() {
+	r := &repl{
+		expander:  expand.NewExpander(),
+		evaluator: eval.NewWithOptions(eval.Options{MaxSteps: 10_000_000, MaxDepth: 10_000}),
+		out:       os.Stdout,
+	}
+
+	flag.BoolVar(&r.expand, "expand", false, "expand syntax-rules macros")
+	flag.BoolVar(&r.eval, "eval", false, "evaluate each form and print its value")
+	flag.IntVar(&r.width, "width", 80, "break output lines longer than `n` columns")
+	history := flag.String("history", defaultHistory(), "append entries to `file`")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: macro-repl [-expand] [-eval] [-width n] [-history file] [file ...]")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *history != "" {
+		if err := r.openHistory(*history); err != nil {
+			fmt.Fprintln(os.Stderr, "macro-repl:", err)
+		}
+	}
+
+	for _, file := range flag.Args() {
+		r.load(file)
+	}
+
+	r.run(bufio.NewReader(os.Stdin), interactive())
+}
+
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".macro_repl_history")
+}
+
+// interactive reports whether standard input is a terminal, in which case
+// prompts are printed.
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *repl) run(in *bufio.Reader, prompt bool) {
+	var entry strings.Builder
+
+	for {
+		if prompt {
+			if entry.Len() == 0 {
+				fmt.Fprint(r.out, "> ")
+			} else {
+				fmt.Fprint(r.out, ". ")
+			}
+		}
+
+		line, err := in.ReadString('\n')
+		entry.WriteString(line)
+
+		done := complete(entry.String())
+
+		if err == nil && !done {
+			continue
+		}
+
+		src := strings.TrimSpace(entry.String())
+		entry.Reset()
+
+		if src != "" {
+			if done {
+				r.addHistory(src)
+			}
+
+			if !r.handle(src) {
+				return
+			}
+		}
+
+		if err != nil {
+			if prompt {
+				fmt.Fprintln(r.out)
+			}
+
+			return
+		}
+	}
+}
+
+// handle runs a command or processes the forms of an entry, reporting
+// whether to read another.
+func (r *repl) handle(src string) bool {
+	if !strings.HasPrefix(src, ":") {
+		r.process(src, "")
+		return true
+	}
+
+	cmd, arg, _ := strings.Cut(src[1:], " ")
+	arg = strings.TrimSpace(arg)
+
+	switch cmd {
+	case "load":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, "usage: :load file")
+		} else {
+			r.load(arg)
+		}
+
+	case "history":
+		for i, entry := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+
+	case "help":
+		fmt.Fprintln(r.out, ":load file   read, expand and evaluate the forms of a file")
+		fmt.Fprintln(r.out, ":history     list the entries read so far")
+		fmt.Fprintln(r.out, ":help        list the commands")
+		fmt.Fprintln(r.out, ":quit        exit")
+
+	case "quit", "q":
+		return false
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command :%s (try :help)\n", cmd)
+	}
+
+	return true
+}
+
+func (r *repl) load(file string) {
+	src, err := os.ReadFile(file)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	r.process(string(src), file)
+}
+
+// process decodes the forms in src, expands and evaluates them as enabled,
+// and prints the results. Errors are printed and end the processing of src.
+func (r *repl) process(src, file string) {
+	d := macro.NewDecoderWithOptions(strings.NewReader(src), macro.DecoderOptions{
+		Scanner: macro.ScannerOptions{File: file, QuotedSymbols: true},
+	})
+
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+
+		forms = append(forms, v)
+	}
+
+	if r.expand {
+		var err error
+
+		if forms, err = r.expander.Expand(forms...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+
+	if !r.eval {
+		for _, form := range forms {
+			r.print(form.Datum)
+		}
+
+		return
+	}
+
+	// An interrupt cancels the evaluation rather than ending the session.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for _, form := range forms {
+		val, err := r.evaluator.EvalContext(ctx, form)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+
+		switch val.(type) {
+		case nil:
+
+		case *eval.Procedure, *eval.Builtin:
+			fmt.Fprintln(r.out, val)
+
+		default:
+			r.print(display(val))
+		}
+	}
+}
+
+func (r *repl) print(datum any) {
+	e := macro.NewEncoderWithOptions(r.out, macro.EncoderOptions{
+		Printer: macro.PrinterOptions{QuotedSymbols: true},
+		Width:   r.width,
+	})
+
+	if err := e.Encode(datum); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	if err := e.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	fmt.Fprintln(r.out)
+}
+
+// display converts the values eval produces that have no S-expression
+// syntax, bools and procedures, into symbols for printing.
+func display(val any) any {
+	switch v := val.(type) {
+	case bool:
+		if v {
+			return macro.Symbol("true")
+		}
+
+		return macro.Symbol("false")
+
+	case *eval.Procedure, *eval.Builtin:
+		return macro.Symbol(fmt.Sprint(v))
+
+	case []any:
+		list := make([]any, len(v))
+
+		for i, elem := range v {
+			list[i] = display(elem)
+		}
+
+		return list
+
+	case macro.Pair:
+		return macro.Pair{Car: display(v.Car), Cdr: display(v.Cdr)}
+
+	case nil:
+		return []any{}
+	}
+
+	return val
+}
+
+// complete reports whether src holds whole forms: its delimiters balance
+// and it does not end with a prefix such as ' awaiting a datum. Input the
+// scanner rejects counts as complete, so that the error is reported.
+func complete(src string) bool {
+	s := macro.NewScannerWithOptions(strings.NewReader(src), macro.ScannerOptions{
+		QuotedSymbols: true,
+		Tags:          []string{"inst"},
+	})
+	depth, prefix := 0, false
+
+	for {
+		tok, err := s.Scan()
+
+		if err != nil {
+			return true
+		}
+
+		switch tok.Kind {
+		case macro.TokenEnd:
+			return depth <= 0 && !prefix
+
+		case macro.TokenLeftParenthesis, macro.TokenLeftSquare, macro.TokenLeftCurly, macro.TokenLeftSet:
+			depth++
+			prefix = false
+
+		case macro.TokenRightParenthesis, macro.TokenRightSquare, macro.TokenRightCurly:
+			depth--
+			prefix = false
+
+		case macro.TokenQuote, macro.TokenQuasiquote, macro.TokenUnquote, macro.TokenTag:
+			prefix = true
+
+		case macro.TokenWhitespace, macro.TokenComment, macro.TokenNewline:
+
+		default:
+			prefix = false
+		}
+	}
+}
+
+// openHistory reads the entries of earlier sessions from file and opens it
+// for appending.
+func (r *repl) openHistory(file string) error {
+	src, err := os.ReadFile(file)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var entry strings.Builder
+
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		entry.WriteString(line)
+
+		if complete(entry.String()) {
+			if s := strings.TrimSpace(entry.String()); s != "" {
+				r.history = append(r.history, s)
+			}
+
+			entry.Reset()
+		}
+	}
+
+	r.file, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	return err
+}
+
+func (r *repl) addHistory(entry string) {
+	r.history = append(r.history, entry)
+
+	if r.file != nil {
+		fmt.Fprintln(r.file, entry)
+	}
+}
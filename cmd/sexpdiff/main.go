@@ -0,0 +1,159 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Command sexpdiff compares S-expression files structurally.
+//
+// Usage:
+//
+//	sexpdiff [-patch] old new
+//	sexpdiff -apply patch file
+//
+// The top-level forms of each file form a list, so the first index of every
+// path is the index of a top-level form. By default each change is printed
+// with the position of the element in the old file, or in the new file for
+// insertions. With -patch the changes are printed as a patch, which -apply
+// applies to a file, printing the resulting forms. Files and patches are
+// read, and output written, with |...| quoted symbols. The exit status is 1
+// if the files differ and 2 on error.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/diff"
+)
+
+func main() {
+	patch := flag.Bool("patch", false, "print the changes as a patch")
+	apply := flag.Bool("apply", false, "apply a patch to a file")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpdiff [-patch] old new")
+		fmt.Fprintln(os.Stderr, "       sexpdiff -apply patch file")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	if *apply {
+		applyPatch(w, flag.Arg(0), flag.Arg(1))
+		flush(w)
+		return
+	}
+
+	changes := diff.Diff(read(flag.Arg(0)), read(flag.Arg(1)))
+
+	if *patch {
+		write(w, diff.Format(changes))
+	} else {
+		for _, c := range changes {
+			pos := c.Old.Pos
+
+			if c.Kind == diff.Insert {
+				pos = c.New.Pos
+			}
+
+			fmt.Fprintf(w, "%s %s\n", pos, c)
+		}
+	}
+
+	flush(w)
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func applyPatch(w *bufio.Writer, patchFile, file string) {
+	src, err := os.ReadFile(patchFile)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	changes, err := diff.Parse(string(src))
+
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", patchFile, err))
+	}
+
+	forms, err := diff.Apply(read(file).Datum, changes)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	list, ok := forms.([]any)
+
+	if !ok {
+		fatal(fmt.Errorf("patch replaced the file with a single datum"))
+	}
+
+	for _, form := range list {
+		write(w, form)
+	}
+}
+
+func read(file string) macro.Value {
+	f, err := os.Open(file)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	defer f.Close()
+
+	d := macro.NewDecoderWithOptions(bufio.NewReader(f), macro.DecoderOptions{
+		Scanner: macro.ScannerOptions{File: file, QuotedSymbols: true},
+	})
+
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return macro.ListOf(forms...)
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		forms = append(forms, v)
+	}
+}
+
+func write(w *bufio.Writer, datum any) {
+	b, err := macro.Marshal(datum)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	w.Write(b)
+	w.WriteByte('\n')
+}
+
+func flush(w *bufio.Writer) {
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "sexpdiff:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Command sexpq prints the values a query selects from S-expression files.
+//
+// Usage:
+//
+//	sexpq [-pos] query [file ...]
+//
+// The top-level forms of each file, or of standard input if no files are
+// given, form a list that the query is applied to. Each selected value is
+// printed on its own line. The exit status is 1 if nothing was selected and
+// 2 on error.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/query"
+)
+
+func main() {
+	pos := flag.Bool("pos", false, "prefix each value with its position")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpq [-pos] query [file ...]")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	q, err := query.Parse(flag.Arg(0))
+
+	if err != nil {
+		fatal(err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	found := false
+
+	for _, doc := range documents(flag.Args()[1:]) {
+		for _, v := range q.SelectValue(doc) {
+			found = true
+
+			if *pos {
+				fmt.Fprintf(w, "%s ", v.Pos)
+			}
+
+			b, err := macro.Marshal(v.Datum)
+
+			if err != nil {
+				fatal(fmt.Errorf("%s %w", v.Pos, err))
+			}
+
+			w.Write(b)
+			w.WriteByte('\n')
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+
+	if !found {
+		os.Exit(1)
+	}
+}
+
+func documents(files []string) []macro.Value {
+	if len(files) == 0 {
+		doc, err := read(os.Stdin, "")
+
+		if err != nil {
+			fatal(err)
+		}
+
+		return []macro.Value{doc}
+	}
+
+	var docs []macro.Value
+
+	for _, file := range files {
+		f, err := os.Open(file)
+
+		if err != nil {
+			fatal(err)
+		}
+
+		doc, err := read(f, file)
+		f.Close()
+
+		if err != nil {
+			fatal(err)
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs
+}
+
+func read(r io.Reader, file string) (macro.Value, error) {
+	d := macro.NewDecoderWithOptions(bufio.NewReader(r), macro.DecoderOptions{
+		Scanner: macro.ScannerOptions{File: file},
+	})
+
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return macro.ListOf(forms...), nil
+		}
+
+		if err != nil {
+			return macro.Value{}, err
+		}
+
+		forms = append(forms, v)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "sexpq:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Command sexpvalidate checks S-expression files against a schema.
+//
+// Usage:
+//
+//	sexpvalidate -schema file [file ...]
+//
+// Every top-level form of each file, or of standard input if no files are
+// given, is validated against the root type of the schema. Errors are printed
+// one per line. The exit status is 1 if any file is invalid and 2 if the
+// schema cannot be read.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/schema"
+)
+
+func main() {
+	schemaFile := flag.String("schema", "", "schema `file`")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpvalidate -schema file [file ...]")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *schemaFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s, err := readSchema(*schemaFile)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sexpvalidate:", err)
+		os.Exit(2)
+	}
+
+	valid := true
+
+	if flag.NArg() == 0 {
+		valid = validate(os.Stdin, "", s)
+	}
+
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "sexpvalidate:", err)
+			valid = false
+			continue
+		}
+
+		if !validate(f, file, s) {
+			valid = false
+		}
+
+		f.Close()
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+func readSchema(file string) (*schema.Schema, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return schema.Read(bufio.NewReader(f), file)
+}
+
+func validate(r io.Reader, file string, s *schema.Schema) bool {
+	d := macro.NewDecoderWithOptions(bufio.NewReader(r), macro.DecoderOptions{
+		Scanner: macro.ScannerOptions{File: file},
+	})
+
+	valid := true
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return valid
+		}
+
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+
+		if err := schema.Validate(v, s); err != nil {
+			fmt.Println(err)
+			valid = false
+		}
+	}
+}
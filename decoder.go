@@ -16,93 +16,470 @@ const (
 	scopeList
 	scopeListLiteral
 	scopeDictLiteral
+	scopeSetLiteral
 	scopeQuote
 )
 
+type dot struct{}
+
+type DictMode int
+
+const (
+	// DictList decodes {k v ...} to the list (dict k v ...).
+	DictList DictMode = iota
+
+	// DictMap decodes {k v ...} to a map[any]any.
+	DictMap
+
+	// DictOrdered decodes {k v ...} to a *Dict[any] preserving key order.
+	DictOrdered
+)
+
+type DecoderOptions struct {
+	Scanner ScannerOptions
+
+	Dicts DictMode
+
+	// MaxDepth limits the nesting of lists, literals and quotes.
+	MaxDepth int
+
+	// MaxAtomBytes limits the size of a single token such as a string. It
+	// overrides Scanner.MaxTokenBytes when set.
+	MaxAtomBytes int
+
+	// MaxListLength limits the number of elements in a list or literal.
+	MaxListLength int
+
+	// MaxTokens limits the total number of tokens read, including whitespace
+	// and comments.
+	MaxTokens int
+}
+
 type Decoder struct {
+	opts    DecoderOptions
 	scanner *Scanner
+	tags    map[Symbol]func(any) (any, error)
+	macros  map[string]func(*Decoder, *Token) (any, error)
+	values  bool
+	peeked  *Token
+	err     error
+	stack   []TokenKind
+	depth   int
+	tokens  int
+	end     Position
 }
 
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{
-		scanner: NewScanner(r),
+	return NewDecoderWithOptions(r, DecoderOptions{})
+}
+
+func NewDecoderWithOptions(r io.Reader, opts DecoderOptions) *Decoder {
+	if opts.MaxAtomBytes > 0 {
+		opts.Scanner.MaxTokenBytes = opts.MaxAtomBytes
+	}
+
+	d := &Decoder{
+		opts:    opts,
+		scanner: NewScannerWithOptions(r, opts.Scanner),
+		tags:    map[Symbol]func(any) (any, error){},
+		macros:  map[string]func(*Decoder, *Token) (any, error){},
+	}
+
+	d.RegisterTag("inst", decodeInst)
+	return d
+}
+
+// RegisterTag sets the constructor called with the datum following #tag.
+// With a nil constructor the literal decodes to a Tagged value. Unregistered
+// names such as #t read as symbols. The constructor must return a datum. With
+// ScannerOptions.FoldCase the tag is folded to lower case, as it is read.
+func (d *Decoder) RegisterTag(tag Symbol, fn func(any) (any, error)) {
+	d.tags[Symbol(d.scanner.fold(string(tag)))] = fn
+	d.scanner.RegisterTag(string(tag))
+}
+
+// RegisterMacro sets the reader macro called when prefix starts a datum. The
+// callback receives the TokenMacro token and typically reads what follows with
+// DecodeDatum or Scanner.
+func (d *Decoder) RegisterMacro(prefix string, fn func(*Decoder, *Token) (any, error)) {
+	d.scanner.RegisterMacro(prefix)
+	d.macros[prefix] = fn
+}
+
+func (d *Decoder) Scanner() *Scanner {
+	return d.scanner
+}
+
+// More reports whether another datum follows, either at the top level or in
+// the list most recently opened by Token.
+func (d *Decoder) More() bool {
+	tok, err := d.peek()
+
+	if err != nil {
+		return true
+	}
+
+	switch tok.Kind {
+	case TokenRightParenthesis, TokenRightSquare, TokenRightCurly, TokenEnd:
+		return false
+	}
+
+	return true
+}
+
+// Token returns the next token of the input, skipping whitespace, comments and
+// newlines, and checking that delimiters are balanced. At the end of the input
+// it returns io.EOF. Token may be interleaved with Decode to read the elements
+// of a list one at a time.
+func (d *Decoder) Token() (*Token, error) {
+	tok, err := d.peek()
+
+	if err != nil {
+		return nil, err
 	}
+
+	d.peeked = nil
+
+	switch tok.Kind {
+	case TokenLeftParenthesis, TokenLeftSquare, TokenLeftCurly, TokenLeftSet:
+		d.stack = append(d.stack, tok.Kind)
+
+	case TokenRightParenthesis, TokenRightSquare, TokenRightCurly:
+		if len(d.stack) == 0 || closingDelimiter(d.stack[len(d.stack)-1]) != tok.Kind {
+			return nil, fmt.Errorf("%s unexpected %s", tok.Pos, delimiter(tok.Kind))
+		}
+
+		d.stack = d.stack[:len(d.stack)-1]
+
+	case TokenEnd:
+		if len(d.stack) > 0 {
+			return nil, fmt.Errorf("%s unexpected eof", tok.Pos)
+		}
+
+		return nil, io.EOF
+	}
+
+	return tok, nil
 }
 
 func (d *Decoder) Decode() (any, error) {
+	d.values = false
+	val, err := d.decode(scopeDoc)
+	return val.Datum, err
+}
+
+// DecodeValue decodes like Decode but also records the position of every
+// nested datum in the returned Value.
+func (d *Decoder) DecodeValue() (Value, error) {
+	d.values = true
 	return d.decode(scopeDoc)
 }
 
-func (d *Decoder) decode(scope scopeType) (any, error) {
+// DecodeDatum decodes the next datum, treating closing delimiters and the end
+// of input as errors.
+func (d *Decoder) DecodeDatum() (any, error) {
+	val, err := d.decode(scopeQuote)
+	return val.Datum, err
+}
+
+func (d *Decoder) decode(scope scopeType) (val Value, err error) {
+	d.depth++
+
+	defer func() {
+		d.depth--
+		val.End = d.end
+	}()
+
 	for {
-		tok, err := d.scanner.Scan()
+		tok, err := d.scan()
 
 		if err != nil {
-			return nil, err
+			return Value{}, err
+		}
+
+		switch tok.Kind {
+		case TokenLeftParenthesis, TokenLeftSquare, TokenLeftCurly, TokenLeftSet,
+			TokenQuote, TokenQuasiquote, TokenUnquote, TokenTag, TokenMacro:
+
+			if max := d.opts.MaxDepth; max > 0 && d.depth > max {
+				return Value{}, &LimitError{"nesting depth", max, tok.Pos}
+			}
 		}
 
 		switch tok.Kind {
 		case TokenInt:
 			val, err := strconv.Atoi(tok.Val)
-			return val, err
+			return Value{Datum: val, Pos: tok.Pos}, err
 
 		case TokenFloat:
 			val, err := strconv.ParseFloat(tok.Val, 64)
-			return val, err
+			return Value{Datum: val, Pos: tok.Pos}, err
 
 		case TokenString:
-			return tok.Val, nil
+			return Value{Datum: tok.Val, Pos: tok.Pos}, nil
 
 		case TokenSymbol:
-			return Symbol(tok.Val), nil
+			return Value{Datum: Symbol(tok.Val), Pos: tok.Pos}, nil
 
 		case TokenLeftParenthesis:
-			return d.decodeList(scopeList, []any{})
+			return d.decodeList(scopeList, "", tok.Pos)
 
 		case TokenRightParenthesis:
-			return nil, d.checkEndDelimiter(scope == scopeList, tok.Pos, ")")
+			return Value{}, d.checkEndDelimiter(scope == scopeList, tok.Pos, ")")
 
 		case TokenLeftSquare:
-			return d.decodeList(scopeListLiteral, []any{Symbol("list")})
+			return d.decodeList(scopeListLiteral, "list", tok.Pos)
 
 		case TokenRightSquare:
-			return nil, d.checkEndDelimiter(scope == scopeListLiteral, tok.Pos, "]")
+			return Value{}, d.checkEndDelimiter(scope == scopeListLiteral, tok.Pos, "]")
 
 		case TokenLeftCurly:
-			return d.decodeList(scopeDictLiteral, []any{Symbol("dict")})
+			if d.opts.Dicts != DictList {
+				return d.decodeDict(tok.Pos)
+			}
+
+			return d.decodeList(scopeDictLiteral, "dict", tok.Pos)
 
 		case TokenRightCurly:
-			return nil, d.checkEndDelimiter(scope == scopeDictLiteral, tok.Pos, "}")
+			return Value{}, d.checkEndDelimiter(scope == scopeDictLiteral || scope == scopeSetLiteral, tok.Pos, "}")
+
+		case TokenLeftSet:
+			return d.decodeList(scopeSetLiteral, "set", tok.Pos)
 
 		case TokenQuote:
-			return d.decodeQuoted("quote")
+			return d.decodeQuoted("quote", tok.Pos)
 
 		case TokenQuasiquote:
-			return d.decodeQuoted("quasiquote")
+			return d.decodeQuoted("quasiquote", tok.Pos)
 
 		case TokenUnquote:
-			return d.decodeQuoted("unquote")
+			return d.decodeQuoted("unquote", tok.Pos)
+
+		case TokenTag:
+			return d.decodeTagged(Symbol(tok.Val), tok.Pos)
+
+		case TokenMacro:
+			return d.decodeMacro(tok)
+
+		case TokenDot:
+			if scope != scopeList {
+				return Value{}, fmt.Errorf("%s unexpected .", tok.Pos)
+			}
+
+			return Value{Datum: dot{}, Pos: tok.Pos}, nil
 
 		case TokenEnd:
-			return nil, d.checkEndDelimiter(scope == scopeDoc, tok.Pos, "eof")
+			if scope == scopeDoc && len(d.stack) == 0 {
+				return Value{}, io.EOF
+			}
+
+			return Value{}, fmt.Errorf("%s unexpected eof", tok.Pos)
+		}
+	}
+}
+
+func (d *Decoder) scan() (*Token, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	tok := d.peeked
+	d.peeked = nil
+
+	if tok == nil {
+		var err error
+
+		if tok, err = d.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	d.end = tok.End
+	return tok, nil
+}
+
+func (d *Decoder) next() (*Token, error) {
+	tok, err := d.scanner.Scan()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d.tokens++; d.opts.MaxTokens > 0 && d.tokens > d.opts.MaxTokens {
+		return nil, &LimitError{"token count", d.opts.MaxTokens, tok.Pos}
+	}
+
+	return tok, nil
+}
+
+func (d *Decoder) peek() (*Token, error) {
+	for d.peeked == nil {
+		if d.err != nil {
+			return nil, d.err
 		}
+
+		tok, err := d.next()
+
+		if err != nil {
+			d.err = err
+			return nil, err
+		}
+
+		switch tok.Kind {
+		case TokenWhitespace, TokenComment, TokenNewline:
+			continue
+		}
+
+		d.peeked = tok
 	}
+
+	return d.peeked, nil
 }
 
-func (d *Decoder) decodeList(scope scopeType, list []any) ([]any, error) {
+func (d *Decoder) decodeList(scope scopeType, head Symbol, pos Position) (Value, error) {
+	list := Value{Datum: []any{}, Pos: pos}
+
+	if head != "" {
+		d.appendItem(&list, Value{Datum: head, Pos: pos, End: d.end})
+	}
+
 	for {
 		val, err := d.decode(scope)
 
 		if err != nil {
-			return nil, err
+			return Value{}, err
+		}
+
+		if _, ok := val.Datum.(dot); ok {
+			return d.decodeTail(list, val.Pos)
 		}
 
-		if val != nil {
-			list = append(list, val)
-		} else {
+		if val.Datum == nil {
 			return list, nil
 		}
+
+		if err := d.checkListLength(len(list.Datum.([]any)), head, val.Pos); err != nil {
+			return Value{}, err
+		}
+
+		d.appendItem(&list, val)
+	}
+}
+
+func (d *Decoder) checkListLength(n int, head Symbol, pos Position) error {
+	if head != "" {
+		n--
+	}
+
+	if max := d.opts.MaxListLength; max > 0 && n >= max {
+		return &LimitError{"list length", max, pos}
+	}
+
+	return nil
+}
+
+func (d *Decoder) decodeDict(pos Position) (Value, error) {
+	dict := NewDict[any]()
+
+	for {
+		key, err := d.decode(scopeDictLiteral)
+
+		if err != nil {
+			return Value{}, err
+		}
+
+		if key.Datum == nil {
+			break
+		}
+
+		if !isDictKey(key.Datum) {
+			return Value{}, fmt.Errorf("%s unexpected %s as dict key", key.Pos, Describe(key.Datum))
+		}
+
+		if _, ok := dict.Get(key.Datum); ok {
+			return Value{}, fmt.Errorf("%s duplicate dict key %v", key.Pos, key.Datum)
+		}
+
+		if err := d.checkListLength(dict.Len()*2, "", key.Pos); err != nil {
+			return Value{}, err
+		}
+
+		val, err := d.decode(scopeDictLiteral)
+
+		if err != nil {
+			return Value{}, err
+		}
+
+		if val.Datum == nil {
+			return Value{}, fmt.Errorf("%s missing value for dict key %v", key.Pos, key.Datum)
+		}
+
+		if err := d.checkListLength(dict.Len()*2+1, "", val.Pos); err != nil {
+			return Value{}, err
+		}
+
+		dict.Set(key.Datum, val.Datum)
+	}
+
+	if d.opts.Dicts == DictOrdered {
+		return Value{Datum: dict, Pos: pos}, nil
+	}
+
+	m := make(map[any]any, dict.Len())
+
+	for k, v := range dict.All() {
+		m[k] = v
+	}
+
+	return Value{Datum: m, Pos: pos}, nil
+}
+
+func (d *Decoder) appendItem(list *Value, val Value) {
+	list.Datum = append(list.Datum.([]any), val.Datum)
+
+	if d.values {
+		list.items = append(list.items, val)
+	}
+}
+
+func (d *Decoder) decodeTail(list Value, pos Position) (Value, error) {
+	elems := list.Datum.([]any)
+
+	if len(elems) == 0 {
+		return Value{}, fmt.Errorf("%s unexpected . at start of list", pos)
+	}
+
+	tail, err := d.decode(scopeQuote)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	end, err := d.decode(scopeList)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	if end.Datum != nil {
+		return Value{}, fmt.Errorf("%s more than one datum after .", pos)
+	}
+
+	if v, ok := tail.Datum.([]any); ok {
+		if err := d.checkListLength(len(elems)+len(v)-1, "", tail.Pos); err != nil {
+			return Value{}, err
+		}
+
+		list.Datum = append(elems, v...)
+		list.items = append(list.items, tail.items...)
+		return list, nil
+	}
+
+	for i := len(elems) - 1; i >= 0; i-- {
+		tail.Datum = Pair{elems[i], tail.Datum}
 	}
+
+	return Value{Datum: tail.Datum, Pos: list.Pos}, nil
 }
 
 func (d *Decoder) checkEndDelimiter(expected bool, pos Position, delim string) error {
@@ -113,12 +490,86 @@ func (d *Decoder) checkEndDelimiter(expected bool, pos Position, delim string) e
 	return nil
 }
 
-func (d *Decoder) decodeQuoted(name string) (any, error) {
+func (d *Decoder) decodeQuoted(name Symbol, pos Position) (Value, error) {
+	end := d.end
 	val, err := d.decode(scopeQuote)
 
 	if err != nil {
-		return nil, err
+		return Value{}, err
+	}
+
+	list := Value{Datum: []any{}, Pos: pos}
+	d.appendItem(&list, Value{Datum: name, Pos: pos, End: end})
+	d.appendItem(&list, val)
+	return list, nil
+}
+
+func (d *Decoder) decodeTagged(tag Symbol, pos Position) (Value, error) {
+	val, err := d.decode(scopeQuote)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	fn := d.tags[tag]
+
+	if fn == nil {
+		return Value{Datum: Tagged{tag, val.Datum}, Pos: pos, End: val.End}, nil
+	}
+
+	datum, err := fn(val.Datum)
+
+	if err != nil {
+		return Value{}, fmt.Errorf("%s invalid #%s: %w", pos, tag, err)
+	}
+
+	if datum == nil {
+		return Value{}, fmt.Errorf("%s tag #%s returned no datum", pos, tag)
+	}
+
+	return Value{Datum: datum, Pos: pos, End: val.End}, nil
+}
+
+func (d *Decoder) decodeMacro(tok *Token) (Value, error) {
+	fn, ok := d.macros[tok.Val]
+
+	if !ok {
+		return Value{}, fmt.Errorf("%s unexpected %s", tok.Pos, tok.Val)
 	}
 
-	return []any{Symbol(name), val}, nil
+	values := d.values
+	datum, err := fn(d, tok)
+	d.values = values
+
+	if err == nil && datum == nil {
+		err = fmt.Errorf("%s reader macro %s returned no datum", tok.Pos, tok.Val)
+	}
+
+	return Value{Datum: datum, Pos: tok.Pos}, err
+}
+
+func closingDelimiter(kind TokenKind) TokenKind {
+	switch kind {
+	case TokenLeftParenthesis:
+		return TokenRightParenthesis
+
+	case TokenLeftSquare:
+		return TokenRightSquare
+
+	default:
+		return TokenRightCurly
+	}
+}
+
+func delimiter(kind TokenKind) string {
+	switch kind {
+	case TokenRightParenthesis:
+		return ")"
+
+	case TokenRightSquare:
+		return "]"
+
+	default:
+		return "}"
+	}
 }
@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeTag(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`(#t #uuid "x" #inst "2025-01-02T03:04:05Z")`))
+	d.RegisterTag("uuid", nil)
+	v, err := d.DecodeValue()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ := v.List()
+
+	if len(items) != 3 {
+		t.Fatalf("decoded %d items, want 3", len(items))
+	}
+
+	if !Equal(items[0].Datum, Symbol("#t")) {
+		t.Errorf("#t decoded to %#v, want the symbol #t", items[0].Datum)
+	}
+
+	if !Equal(items[1].Datum, Tagged{"uuid", "x"}) {
+		t.Errorf(`#uuid "x" decoded to %#v, want Tagged`, items[1].Datum)
+	}
+
+	if items[1].End.Offset != 13 {
+		t.Errorf(`#uuid "x" ends at offset %d, want 13`, items[1].End.Offset)
+	}
+}
+
+func TestDecodeTagNoDatum(t *testing.T) {
+	d := NewDecoder(strings.NewReader("(a #null 0 b c)"))
+	d.RegisterTag("null", func(any) (any, error) { return nil, nil })
+	_, err := d.Decode()
+
+	if err == nil || err.Error() != "[1:4] tag #null returned no datum" {
+		t.Errorf("Decode = %v, want no datum error", err)
+	}
+}
+
+func TestDecodeTagFoldCase(t *testing.T) {
+	d := NewDecoderWithOptions(strings.NewReader(`#UUID "x"`), DecoderOptions{
+		Scanner: ScannerOptions{FoldCase: true},
+	})
+
+	d.RegisterTag("UUID", func(val any) (any, error) { return []any{Symbol("uuid"), val}, nil })
+	datum, err := d.Decode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []any{Symbol("uuid"), "x"}; !Equal(datum, want) {
+		t.Errorf("Decode = %#v, want %#v", datum, want)
+	}
+}
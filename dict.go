@@ -0,0 +1,81 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"iter"
+	"slices"
+)
+
+// Dict is a map that remembers the order in which keys were first set. Keys
+// must be comparable atoms such as Symbol, string, int or float64.
+type Dict[V any] struct {
+	keys  []any
+	vals  []V
+	index map[any]int
+}
+
+func NewDict[V any]() *Dict[V] {
+	return &Dict[V]{
+		index: map[any]int{},
+	}
+}
+
+func (m *Dict[V]) Len() int {
+	return len(m.keys)
+}
+
+func (m *Dict[V]) Get(key any) (V, bool) {
+	if i, ok := m.index[key]; ok {
+		return m.vals[i], true
+	}
+
+	var zero V
+	return zero, false
+}
+
+func (m *Dict[V]) Set(key any, val V) {
+	if i, ok := m.index[key]; ok {
+		m.vals[i] = val
+		return
+	}
+
+	m.index[key] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.vals = append(m.vals, val)
+}
+
+func (m *Dict[V]) Keys() []any {
+	return m.keys
+}
+
+func (m *Dict[V]) All() iter.Seq2[any, V] {
+	return func(yield func(any, V) bool) {
+		for i, k := range m.keys {
+			if !yield(k, m.vals[i]) {
+				return
+			}
+		}
+	}
+}
+
+func isDictKey(key any) bool {
+	switch key.(type) {
+	case int, float64, string, Symbol:
+		return true
+	}
+
+	return false
+}
+
+func sortedKeys[V any](m map[any]V) []any {
+	keys := make([]any, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.SortFunc(keys, Compare)
+	return keys
+}
@@ -0,0 +1,486 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package diff computes structural differences between decoded S-expressions
+// and applies them as patches.
+//
+// A diff is a sequence of changes to be applied in order. Each change locates
+// an element by its path, the list of indexes leading to it from the root, in
+// the tree as it is when the change is applied. Elements of a list are matched
+// by a longest common subsequence; equal elements that changed position are
+// reported as moves, and the remaining elements are paired up by position, so
+// that a changed atom, or a list whose head symbol changed, is a replacement
+// and any other changed list is diffed recursively.
+package diff
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/mowen132/macro"
+)
+
+type Kind int
+
+const (
+	Insert Kind = iota
+	Delete
+	Replace
+	Move
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Insert:
+		return "insert"
+
+	case Delete:
+		return "delete"
+
+	case Replace:
+		return "replace"
+
+	case Move:
+		return "move"
+
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Change is a single edit. Old is the element removed, replaced or moved, as
+// found in the old tree; New is the element inserted, the replacement, or the
+// moved element as found in the new tree. A move removes the element at Path
+// and inserts it at index To of the same list, counted after the removal.
+type Change struct {
+	Kind Kind
+	Path []int
+	To   int
+	Old  macro.Value
+	New  macro.Value
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Insert:
+		return fmt.Sprintf("insert %v %s", c.Path, format(c.New.Datum))
+
+	case Delete:
+		return fmt.Sprintf("delete %v %s", c.Path, format(c.Old.Datum))
+
+	case Replace:
+		return fmt.Sprintf("replace %v %s with %s", c.Path, format(c.Old.Datum), format(c.New.Datum))
+
+	case Move:
+		return fmt.Sprintf("move %v to %d %s", c.Path, c.To, format(c.Old.Datum))
+
+	default:
+		return c.Kind.String()
+	}
+}
+
+func format(datum any) string {
+	b, err := macro.Marshal(datum)
+
+	if err != nil {
+		return fmt.Sprint(datum)
+	}
+
+	return string(b)
+}
+
+// Diff returns the changes that turn a into b.
+func Diff(a, b macro.Value) []Change {
+	var changes []Change
+	return diff(changes, nil, a, b)
+}
+
+func diff(changes []Change, path []int, a, b macro.Value) []Change {
+	if macro.Equal(a.Datum, b.Datum) {
+		return changes
+	}
+
+	if a.IsList() && b.IsList() && sameHead(a, b) {
+		return diffList(changes, path, a, b)
+	}
+
+	return append(changes, Change{Kind: Replace, Path: path, Old: a, New: b})
+}
+
+// sameHead reports whether a and b are forms with the same head symbol, or
+// are both lists without one. Other lists are replaced rather than diffed.
+func sameHead(a, b macro.Value) bool {
+	x, errA := a.Head()
+	y, errB := b.Head()
+
+	if errA != nil || errB != nil {
+		return errA != nil && errB != nil
+	}
+
+	return x == y
+}
+
+// Roles of list elements in diffList.
+const (
+	unmatched = iota
+	kept
+	moved
+	paired
+)
+
+type element struct {
+	role  int
+	match int
+}
+
+func diffList(changes []Change, path []int, a, b macro.Value) []Change {
+	olds, _ := a.List()
+	news, _ := b.List()
+
+	oldElems := make([]element, len(olds))
+	newElems := make([]element, len(news))
+
+	for _, m := range lcs(olds, news) {
+		oldElems[m[0]] = element{kept, m[1]}
+		newElems[m[1]] = element{kept, m[0]}
+	}
+
+	// Equal elements outside the common subsequence have moved.
+	for j := range news {
+		if newElems[j].role != unmatched {
+			continue
+		}
+
+		for i := range olds {
+			if oldElems[i].role == unmatched && macro.Equal(olds[i].Datum, news[j].Datum) {
+				oldElems[i] = element{moved, j}
+				newElems[j] = element{moved, i}
+				break
+			}
+		}
+	}
+
+	// Pair the remaining elements between consecutive kept elements.
+	i, j := 0, 0
+
+	for i < len(olds) || j < len(news) {
+		for i < len(olds) && oldElems[i].role != unmatched && oldElems[i].role != kept {
+			i++
+		}
+
+		for j < len(news) && newElems[j].role != unmatched && newElems[j].role != kept {
+			j++
+		}
+
+		switch {
+		case i < len(olds) && j < len(news) && oldElems[i].role == unmatched && newElems[j].role == unmatched:
+			oldElems[i] = element{paired, j}
+			newElems[j] = element{paired, i}
+			i++
+			j++
+
+		case i < len(olds) && oldElems[i].role == unmatched:
+			i++
+
+		case j < len(news) && newElems[j].role == unmatched:
+			j++
+
+		default:
+			i++
+			j++
+		}
+	}
+
+	// Simulate the edits on a list of old element indexes, -1 standing for a
+	// new element already in place, so that every path is correct at the time
+	// its change is applied.
+	cur := make([]int, len(olds))
+
+	for i := range cur {
+		cur[i] = i
+	}
+
+	for i := 0; i < len(cur); {
+		if oldElems[cur[i]].role == unmatched {
+			changes = append(changes, Change{Kind: Delete, Path: child(path, i), Old: olds[cur[i]]})
+			cur = slices.Delete(cur, i, i+1)
+		} else {
+			i++
+		}
+	}
+
+	placed := make([]bool, len(olds))
+	p := 0
+
+	for k, elem := range newElems {
+		// Skip elements waiting to be moved further on.
+		for p < len(cur) && cur[p] >= 0 && oldElems[cur[p]].role == moved && !placed[cur[p]] {
+			p++
+		}
+
+		switch elem.role {
+		case kept:
+			placed[elem.match] = true
+
+		case paired:
+			changes = diff(changes, child(path, p), olds[elem.match], news[k])
+			placed[elem.match] = true
+
+		case moved:
+			from := slices.Index(cur, elem.match)
+			cur = slices.Delete(cur, from, from+1)
+
+			if from < p {
+				p--
+			}
+
+			cur = slices.Insert(cur, p, elem.match)
+			placed[elem.match] = true
+			changes = append(changes, Change{Kind: Move, Path: child(path, from), To: p, Old: olds[elem.match], New: news[k]})
+
+		default:
+			cur = slices.Insert(cur, p, -1)
+			changes = append(changes, Change{Kind: Insert, Path: child(path, p), New: news[k]})
+		}
+
+		p++
+	}
+
+	return changes
+}
+
+func child(path []int, i int) []int {
+	return append(slices.Clip(path), i)
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+func lcs(a, b []macro.Value) [][2]int {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if macro.Equal(a[i].Datum, b[j].Datum) {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	var pairs [][2]int
+
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case macro.Equal(a[i].Datum, b[j].Datum):
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+
+		default:
+			j++
+		}
+	}
+
+	return pairs
+}
+
+// Apply applies changes to datum in order and returns the result. Lists on
+// the paths of the changes are copied rather than modified.
+func Apply(datum any, changes []Change) (any, error) {
+	for _, c := range changes {
+		var err error
+
+		if datum, err = apply(datum, c.Path, c); err != nil {
+			return nil, err
+		}
+	}
+
+	return datum, nil
+}
+
+func apply(datum any, path []int, c Change) (any, error) {
+	if len(path) == 0 {
+		if c.Kind != Replace {
+			return nil, fmt.Errorf("cannot %s the root", c.Kind)
+		}
+
+		return c.New.Datum, nil
+	}
+
+	list, ok := datum.([]any)
+
+	if !ok {
+		return nil, fmt.Errorf("%s %v: expected list, got %s", c.Kind, c.Path, format(datum))
+	}
+
+	i := path[0]
+	limit := len(list)
+
+	if len(path) == 1 && c.Kind == Insert {
+		limit++
+	}
+
+	if i < 0 || i >= limit {
+		return nil, fmt.Errorf("%s %v: index %d out of range", c.Kind, c.Path, i)
+	}
+
+	list = slices.Clone(list)
+
+	if len(path) > 1 {
+		elem, err := apply(list[i], path[1:], c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list[i] = elem
+		return list, nil
+	}
+
+	switch c.Kind {
+	case Insert:
+		list = slices.Insert(list, i, c.New.Datum)
+
+	case Delete:
+		list = slices.Delete(list, i, i+1)
+
+	case Replace:
+		list[i] = c.New.Datum
+
+	case Move:
+		elem := list[i]
+		list = slices.Delete(list, i, i+1)
+
+		if c.To < 0 || c.To > len(list) {
+			return nil, fmt.Errorf("%s %v: index %d out of range", c.Kind, c.Path, c.To)
+		}
+
+		list = slices.Insert(list, c.To, elem)
+
+	default:
+		return nil, fmt.Errorf("unsupported change %s", c.Kind)
+	}
+
+	return list, nil
+}
+
+// Format returns the patch form of changes:
+//
+//	(patch (insert (1 0) datum) (delete (2)) (replace (0 1) datum) (move (3) 0))
+func Format(changes []Change) []any {
+	patch := []any{macro.Symbol("patch")}
+
+	for _, c := range changes {
+		path := make([]any, len(c.Path))
+
+		for i, index := range c.Path {
+			path[i] = index
+		}
+
+		op := []any{macro.Symbol(c.Kind.String()), path}
+
+		switch c.Kind {
+		case Insert, Replace:
+			op = append(op, c.New.Datum)
+
+		case Move:
+			op = append(op, c.To)
+		}
+
+		patch = append(patch, op)
+	}
+
+	return patch
+}
+
+// Parse decodes a patch written by Format and encoded with macro.Marshal,
+// reading |...| as quoted symbols as Unmarshal does.
+func Parse(src string) ([]Change, error) {
+	patch, err := macro.UnmarshalValue([]byte(src))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if head, err := patch.Head(); err != nil || head != "patch" {
+		return nil, fmt.Errorf("%s expected (patch ...)", patch.Pos)
+	}
+
+	ops, _ := patch.Args()
+	changes := make([]Change, len(ops))
+
+	for i, op := range ops {
+		if changes[i], err = parseChange(op); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+var kinds = map[macro.Symbol]Kind{
+	"insert":  Insert,
+	"delete":  Delete,
+	"replace": Replace,
+	"move":    Move,
+}
+
+func parseChange(op macro.Value) (Change, error) {
+	head, err := op.Head()
+
+	if err != nil {
+		return Change{}, err
+	}
+
+	kind, ok := kinds[head]
+
+	if !ok {
+		return Change{}, fmt.Errorf("%s unknown change %s", op.Pos, head)
+	}
+
+	args, _ := op.Args()
+	want := 2
+
+	if kind == Delete {
+		want = 1
+	}
+
+	if len(args) != want {
+		return Change{}, fmt.Errorf("%s expected %d arguments to %s, got %d", op.Pos, want, head, len(args))
+	}
+
+	c := Change{Kind: kind}
+	indexes, err := args[0].List()
+
+	if err != nil {
+		return Change{}, err
+	}
+
+	c.Path = make([]int, len(indexes))
+
+	for i, index := range indexes {
+		if c.Path[i], err = index.AsInt(); err != nil {
+			return Change{}, err
+		}
+	}
+
+	switch kind {
+	case Insert, Replace:
+		c.New = args[1]
+
+	case Move:
+		if c.To, err = args[1].AsInt(); err != nil {
+			return Change{}, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/mowen132/macro"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	a, err := macro.UnmarshalValue([]byte("(a b c)"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := macro.ListOf(a.DeriveList(), macro.Value{Datum: macro.Symbol("|x y|")}, macro.Value{Datum: macro.Symbol("#inst")})
+	want := []any{[]any{}, macro.Symbol("|x y|"), macro.Symbol("#inst")}
+	src, err := macro.Marshal(Format(Diff(a, b)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Parse(string(src))
+
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", src, err)
+	}
+
+	got, err := Apply(a.Datum, changes)
+
+	if err != nil {
+		t.Fatalf("Apply(%s): %v", src, err)
+	}
+
+	if !macro.Equal(got, want) {
+		t.Errorf("Apply(%s) = %#v, want %#v", src, got, want)
+	}
+}
@@ -6,80 +6,310 @@ package macro
 import (
 	"fmt"
 	"io"
+	"math"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Sugar is a set of forms that have a reader shorthand: 'x for (quote x),
+// `x for (quasiquote x), ,x for (unquote x), [...] for (list ...), {...} for
+// (dict ...) and #{...} for (set ...).
+type Sugar int
+
+const (
+	SugarQuote Sugar = 1 << iota
+	SugarQuasiquote
+	SugarUnquote
+	SugarList
+	SugarDict
+	SugarSet
+
+	SugarAll = SugarQuote | SugarQuasiquote | SugarUnquote | SugarList | SugarDict | SugarSet
+)
+
+type EncoderOptions struct {
+	Printer PrinterOptions
+
+	// Canonical lists the forms encoded as ordinary lists, such as (quote x),
+	// rather than with their shorthand. Forms whose arguments do not fit the
+	// shorthand, such as (quote), are always encoded as ordinary lists.
+	Canonical Sugar
+
+	// Width, when positive, breaks lists that would extend past that column
+	// onto several lines. A form keeps its head and first argument on the
+	// first line and indents the other arguments by two spaces, a dict puts
+	// each key-value pair on a line, and other lists fill each line with as
+	// many elements as fit.
+	Width int
+}
+
+// layout selects how a list is broken onto lines when it is too wide.
+type layout int
+
+const (
+	layoutData layout = iota
+	layoutForm
+	layoutDict
+)
+
+// Verbatim is a list encoded in parentheses regardless of its head symbol,
+// so that for example Verbatim{Symbol("quote"), x} is encoded as (quote x)
+// even when quote shorthand is enabled.
+type Verbatim []any
+
 type Encoder struct {
-	printer *Printer
+	opts      EncoderOptions
+	printer   *Printer
+	tags      map[reflect.Type]encoderTag
+	sourceMap SourceMap
+}
+
+type encoderTag struct {
+	tag Symbol
+	fn  func(any) (any, error)
 }
 
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{
-		printer: NewPrinter(w),
+	return NewEncoderWithOptions(w, EncoderOptions{})
+}
+
+func NewEncoderWithOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	e := &Encoder{
+		opts:    opts,
+		printer: NewPrinterWithOptions(w, opts.Printer),
+		tags:    map[reflect.Type]encoderTag{},
 	}
+
+	e.RegisterTag("inst", reflect.TypeFor[time.Time](), encodeInst)
+	return e
+}
+
+// RegisterTag encodes values of type typ as #tag followed by the datum
+// returned by fn. The symbol #tag is then quoted, as it would read back as
+// the tag.
+func (e *Encoder) RegisterTag(tag Symbol, typ reflect.Type, fn func(any) (any, error)) {
+	e.tags[typ] = encoderTag{tag, fn}
+	e.opts.Printer.Tags = append(slices.Clip(e.opts.Printer.Tags), string(tag))
+	e.printer.opts.Tags = e.opts.Printer.Tags
 }
 
+// Encode writes val. A Value is encoded as its datum, and the spans of the
+// datum and of the elements recorded within it are added to the source map.
 func (e *Encoder) Encode(val any) error {
 	var err error
 
 	switch v := val.(type) {
+	case Value:
+		err = e.encodeValue(v)
+
 	case int:
 		err = e.printer.PrintInt(strconv.Itoa(v))
 
 	case float64:
-		err = e.printer.PrintFloat(strconv.FormatFloat(v, 'g', -1, 64))
+		err = e.encodeFloat(v)
 
 	case string:
+		if !utf8.ValidString(v) {
+			return fmt.Errorf("invalid UTF-8 in string %q", v)
+		}
+
 		err = e.printer.PrintString(v)
 
 	case Symbol:
+		if !utf8.ValidString(string(v)) {
+			return fmt.Errorf("invalid UTF-8 in symbol %q", v)
+		}
+
 		err = e.printer.PrintSymbol(string(v))
 
 	case []any:
 		err = e.encodeList(v)
 
+	case Verbatim:
+		err = e.encodeDelimitedList(v, e.printer.PrintLeftParenthesis, e.printer.PrintRightParenthesis, layoutOf([]any(v)))
+
+	case Pair:
+		err = e.encodePair(v)
+
+	case Tagged:
+		err = e.encodeTagged(v.Tag, v.Val)
+
+	case *Dict[any]:
+		err = e.encodeDict(v)
+
 	default:
-		err = fmt.Errorf("unsupported type: %T", val)
+		if t, ok := e.tags[reflect.TypeOf(val)]; ok {
+			var tagged any
+
+			if tagged, err = t.fn(val); err == nil {
+				err = e.encodeTagged(t.tag, tagged)
+			}
+		} else if rv := reflect.ValueOf(val); rv.Kind() == reflect.Map {
+			err = e.encodeMap(rv)
+		} else {
+			err = fmt.Errorf("unsupported type: %T", val)
+		}
 	}
 
 	return err
 }
 
+// EncodeValue writes the datum of v, mapping its output to v's source
+// positions.
+func (e *Encoder) EncodeValue(v Value) error {
+	return e.encodeValue(v)
+}
+
+// SourceMap returns the mappings recorded for the values encoded so far.
+func (e *Encoder) SourceMap() *SourceMap {
+	return &e.sourceMap
+}
+
+func (e *Encoder) encodeValue(v Value) error {
+	datum := v.Datum
+
+	if list, ok := datum.([]any); ok && len(v.items) == len(list) && len(list) > 0 {
+		elems := make([]any, len(v.items))
+
+		for i, item := range v.items {
+			elems[i] = item
+		}
+
+		datum = elems
+	}
+
+	if v.Pos.Line == 0 {
+		return e.Encode(datum)
+	}
+
+	i := len(e.sourceMap.Mappings)
+	e.sourceMap.Mappings = append(e.sourceMap.Mappings, Mapping{Pos: e.printer.Pos(), SourcePos: v.Pos, SourceEnd: v.End})
+
+	if err := e.Encode(datum); err != nil {
+		return err
+	}
+
+	e.sourceMap.Mappings[i].End = e.printer.Pos()
+	return nil
+}
+
+func (e *Encoder) encodeFloat(val float64) error {
+	if math.IsInf(val, 0) || math.IsNaN(val) {
+		return fmt.Errorf("unsupported float value: %v", val)
+	}
+
+	s := strconv.FormatFloat(val, 'g', -1, 64)
+
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return e.printer.PrintFloat(s)
+}
+
 func (e *Encoder) encodeList(list []any) error {
 	p := e.printer
 
 	if len(list) > 0 {
-		if v, ok := list[0].(Symbol); ok {
-			switch v {
-			case "list":
-				return e.encodeDelimitedList(list[1:], p.PrintLeftSquare, p.PrintRightSquare)
+		head := list[0]
 
-			case "dict":
-				return e.encodeDelimitedList(list[1:], p.PrintLeftCurly, p.PrintRightCurly)
+		if v, ok := head.(Value); ok {
+			head = v.Datum
+		}
 
-			case "quote":
-				return e.encodeQuoted(list[1:], p.PrintQuote, "quote")
+		if v, ok := head.(Symbol); ok {
+			switch {
+			case v == "list" && e.sugared(SugarList):
+				return e.encodeDelimitedList(list[1:], p.PrintLeftSquare, p.PrintRightSquare, layoutData)
 
-			case "quasiquote":
-				return e.encodeQuoted(list[1:], p.PrintQuasiquote, "quasiquote")
+			case v == "dict" && e.sugared(SugarDict):
+				return e.encodeDelimitedList(list[1:], p.PrintLeftCurly, p.PrintRightCurly, layoutDict)
 
-			case "unquote":
-				return e.encodeQuoted(list[1:], p.PrintUnquote, "unquote")
+			case v == "set" && e.sugared(SugarSet):
+				return e.encodeDelimitedList(list[1:], p.PrintLeftSet, p.PrintRightCurly, layoutData)
+
+			case v == "quote" && len(list) == 2 && e.sugared(SugarQuote):
+				return e.encodeQuoted(list[1], p.PrintQuote)
+
+			case v == "quasiquote" && len(list) == 2 && e.sugared(SugarQuasiquote):
+				return e.encodeQuoted(list[1], p.PrintQuasiquote)
+
+			case v == "unquote" && len(list) == 2 && e.sugared(SugarUnquote):
+				return e.encodeQuoted(list[1], p.PrintUnquote)
 			}
 		}
 	}
 
-	return e.encodeDelimitedList(list, p.PrintLeftParenthesis, p.PrintRightParenthesis)
+	return e.encodeDelimitedList(list, p.PrintLeftParenthesis, p.PrintRightParenthesis, layoutOf(list))
+}
+
+func (e *Encoder) sugared(form Sugar) bool {
+	return e.opts.Canonical&form == 0
+}
+
+func layoutOf(list []any) layout {
+	if len(list) == 0 {
+		return layoutData
+	}
+
+	head := list[0]
+
+	if v, ok := head.(Value); ok {
+		head = v.Datum
+	}
+
+	if _, ok := head.(Symbol); ok {
+		return layoutForm
+	}
+
+	return layoutData
 }
 
-func (e *Encoder) encodeDelimitedList(list []any, printLeft, printRight func() error) error {
+func (e *Encoder) encodeDelimitedList(list []any, printLeft, printRight func() error, style layout) error {
+	start := e.printer.Pos().Col
+
 	if err := printLeft(); err != nil {
 		return err
 	}
 
+	broken := e.opts.Width > 0 && len(list) > 1 && e.printer.Pos().Col+e.width(list)-1 > e.opts.Width
+	indent := e.printer.Pos().Col
+
+	if style == layoutForm {
+		indent = start + 2
+	}
+
 	for i, v := range list {
 		if i > 0 {
-			if err := e.printer.PrintWhitespace(" "); err != nil {
+			wrap := false
+
+			if broken {
+				switch style {
+				case layoutForm:
+					wrap = i > 1
+
+				case layoutDict:
+					wrap = i%2 == 0
+
+				default:
+					wrap = e.printer.Pos().Col+e.width(list[i:i+1]) > e.opts.Width
+				}
+			}
+
+			if wrap {
+				if err := e.printer.PrintNewline(); err != nil {
+					return err
+				}
+
+				if err := e.printer.PrintWhitespace(strings.Repeat(" ", indent-1)); err != nil {
+					return err
+				}
+			} else if err := e.printer.PrintWhitespace(" "); err != nil {
 				return err
 			}
 		}
@@ -92,16 +322,147 @@ func (e *Encoder) encodeDelimitedList(list []any, printLeft, printRight func() e
 	return printRight()
 }
 
-func (e *Encoder) encodeQuoted(list []any, print func() error, name string) error {
-	if len(list) != 1 {
-		return fmt.Errorf("wrong number of arguments in %s", name)
+// flat returns an encoder with the same options and tags that writes to w
+// on one line, for measuring or checking output before writing it.
+func (e *Encoder) flat(w io.Writer) *Encoder {
+	opts := e.opts
+	opts.Width = 0
+	return &Encoder{opts: opts, printer: NewPrinterWithOptions(w, opts.Printer), tags: e.tags}
+}
+
+// width returns the number of columns the elements of list and the closing
+// delimiter take when encoded on one line.
+func (e *Encoder) width(list []any) int {
+	flat := e.flat(io.Discard)
+
+	for _, v := range list {
+		if err := flat.Encode(v); err != nil {
+			return 0
+		}
+	}
+
+	return flat.printer.Pos().Col - 1 + len(list)
+}
+
+func (e *Encoder) encodeDict(dict *Dict[any]) error {
+	list := make([]any, 0, dict.Len()*2)
+
+	for k, v := range dict.All() {
+		list = append(list, k, v)
+	}
+
+	return e.encodeDelimitedList(list, e.printer.PrintLeftCurly, e.printer.PrintRightCurly, layoutDict)
+}
+
+func (e *Encoder) encodeMap(m reflect.Value) error {
+	entries := make(map[any]any, m.Len())
+
+	for iter := m.MapRange(); iter.Next(); {
+		entries[iter.Key().Interface()] = iter.Value().Interface()
+	}
+
+	list := make([]any, 0, len(entries)*2)
+
+	for _, k := range sortedKeys(entries) {
+		list = append(list, k, entries[k])
+	}
+
+	return e.encodeDelimitedList(list, e.printer.PrintLeftCurly, e.printer.PrintRightCurly, layoutDict)
+}
+
+// encodePair writes a chain of pairs as a dotted list. A list at the end of
+// the chain continues it, so Pair{1, []any{2}} is written (1 2). The tail is
+// checked before anything is written, so an unsupported tail leaves the
+// output unchanged.
+func (e *Encoder) encodePair(pair Pair) error {
+	p := e.printer
+	elems := []any{pair.Car}
+	tail := pair.Cdr
+
+	for {
+		next, ok := tail.(Pair)
+
+		if !ok {
+			break
+		}
+
+		elems = append(elems, next.Car)
+		tail = next.Cdr
+	}
+
+	switch t := tail.(type) {
+	case []any:
+		return e.encodeDelimitedList(append(elems, t...), p.PrintLeftParenthesis, p.PrintRightParenthesis, layoutOf(elems))
+
+	case Verbatim:
+		return e.encodeDelimitedList(append(elems, t...), p.PrintLeftParenthesis, p.PrintRightParenthesis, layoutOf(elems))
+	}
+
+	if err := e.flat(io.Discard).Encode(tail); err != nil {
+		return fmt.Errorf("unsupported pair tail: %w", err)
 	}
 
+	if err := p.PrintLeftParenthesis(); err != nil {
+		return err
+	}
+
+	for _, elem := range elems {
+		if err := e.Encode(elem); err != nil {
+			return err
+		}
+
+		if err := p.PrintWhitespace(" "); err != nil {
+			return err
+		}
+	}
+
+	if err := p.PrintDot(); err != nil {
+		return err
+	}
+
+	if err := p.PrintWhitespace(" "); err != nil {
+		return err
+	}
+
+	if err := e.Encode(tail); err != nil {
+		return err
+	}
+
+	return p.PrintRightParenthesis()
+}
+
+func (e *Encoder) encodeQuoted(val any, print func() error) error {
 	if err := print(); err != nil {
 		return err
 	}
 
-	return e.Encode(list[0])
+	return e.Encode(val)
+}
+
+func (e *Encoder) encodeTagged(tag Symbol, val any) error {
+	if !e.isTag(string(tag)) {
+		return fmt.Errorf("invalid tag: %q", tag)
+	}
+
+	if err := e.printer.PrintTag(string(tag)); err != nil {
+		return err
+	}
+
+	if err := e.printer.PrintWhitespace(" "); err != nil {
+		return err
+	}
+
+	return e.Encode(val)
+}
+
+func (e *Encoder) isTag(tag string) bool {
+	c, n := utf8.DecodeRuneInString(tag)
+
+	if !unicode.IsLetter(c) || e.printer.opts.FoldCase && strings.ToLower(tag) != tag {
+		return false
+	}
+
+	return e.printer.areSymbolChars(tag[n:])
 }
 
 func (e *Encoder) Flush() error {
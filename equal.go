@@ -0,0 +1,410 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"slices"
+)
+
+// Equal reports whether two decoded data are equal. Lists, pairs and tagged
+// literals are compared element by element. Dicts, whether (dict ...) forms,
+// *Dict[any] or map[any]any, are equal if they have equal entries in any
+// order, and (set ...) forms if they have equal elements in any order. An int
+// never equals a float64, just as 1 and 1.0 are distinct literals, and NaN
+// equals itself.
+func Equal(a, b any) bool {
+	if x, ok := dictEntries(a); ok {
+		y, ok := dictEntries(b)
+		return ok && equalEntries(x, y)
+	}
+
+	if x, ok := setElements(a); ok {
+		y, ok := setElements(b)
+		return ok && equalElements(x, y)
+	}
+
+	switch x := a.(type) {
+	case int:
+		y, ok := b.(int)
+		return ok && x == y
+
+	case float64:
+		y, ok := b.(float64)
+		return ok && cmp.Compare(x, y) == 0
+
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+
+	case Symbol:
+		y, ok := b.(Symbol)
+		return ok && x == y
+
+	case []any:
+		y, ok := b.([]any)
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		if _, ok := dictEntries(b); ok {
+			return false
+		}
+
+		if _, ok := setElements(b); ok {
+			return false
+		}
+
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case Pair:
+		y, ok := b.(Pair)
+		return ok && Equal(x.Car, y.Car) && Equal(x.Cdr, y.Cdr)
+
+	case Tagged:
+		y, ok := b.(Tagged)
+		return ok && x.Tag == y.Tag && Equal(x.Val, y.Val)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// Compare orders decoded data totally, consistently with Equal: numbers
+// first, by value with an int before an equal float64, then strings,
+// symbols, lists, dicts, sets, pairs, tagged literals and other values. Lists
+// compare element by element, dicts by their entries sorted by key, and sets
+// by their sorted elements.
+func Compare(a, b any) int {
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c
+	}
+
+	switch x := a.(type) {
+	case int:
+		switch y := b.(type) {
+		case int:
+			return cmp.Compare(x, y)
+
+		case float64:
+			return compareNumbers(x, y)
+		}
+
+	case float64:
+		switch y := b.(type) {
+		case int:
+			return -compareNumbers(y, x)
+
+		case float64:
+			return cmp.Compare(x, y)
+		}
+
+	case string:
+		return cmp.Compare(x, b.(string))
+
+	case Symbol:
+		return cmp.Compare(x, b.(Symbol))
+
+	case Pair:
+		y := b.(Pair)
+
+		if c := Compare(x.Car, y.Car); c != 0 {
+			return c
+		}
+
+		return Compare(x.Cdr, y.Cdr)
+
+	case Tagged:
+		y := b.(Tagged)
+
+		if c := cmp.Compare(x.Tag, y.Tag); c != 0 {
+			return c
+		}
+
+		return Compare(x.Val, y.Val)
+	}
+
+	if x, ok := dictEntries(a); ok {
+		y, _ := dictEntries(b)
+		sortEntries(x)
+		sortEntries(y)
+
+		return slices.CompareFunc(x, y, func(p, q [2]any) int {
+			if c := Compare(p[0], q[0]); c != 0 {
+				return c
+			}
+
+			return Compare(p[1], q[1])
+		})
+	}
+
+	if x, ok := setElements(a); ok {
+		y, _ := setElements(b)
+		x = slices.SortedFunc(slices.Values(x), Compare)
+		y = slices.SortedFunc(slices.Values(y), Compare)
+		return slices.CompareFunc(x, y, Compare)
+	}
+
+	if x, ok := a.([]any); ok {
+		return slices.CompareFunc(x, b.([]any), Compare)
+	}
+
+	if Equal(a, b) {
+		return 0
+	}
+
+	if c := cmp.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(fmt.Sprintf("%#v", a), fmt.Sprintf("%#v", b))
+}
+
+func rank(datum any) int {
+	if _, ok := dictEntries(datum); ok {
+		return 4
+	}
+
+	if _, ok := setElements(datum); ok {
+		return 5
+	}
+
+	switch datum.(type) {
+	case int, float64:
+		return 0
+
+	case string:
+		return 1
+
+	case Symbol:
+		return 2
+
+	case []any:
+		return 3
+
+	case Pair:
+		return 6
+
+	case Tagged:
+		return 7
+	}
+
+	return 8
+}
+
+// compareNumbers compares an int with a float64 by value, ordering the int
+// first if they are equal. NaN orders before every int.
+func compareNumbers(i int, f float64) int {
+	if math.IsNaN(f) {
+		return 1
+	}
+
+	if c := cmp.Compare(float64(i), f); c != 0 {
+		return c
+	}
+
+	// float64(i) rounds large ints, so compare exactly when f is in range.
+	if f >= math.MinInt64 && f < math.MaxInt64 {
+		if c := cmp.Compare(int64(i), int64(f)); c != 0 {
+			return c
+		}
+	}
+
+	return -1
+}
+
+// Hash returns a hash of a decoded datum such that equal data, as reported
+// by Equal, have equal hashes.
+func Hash(datum any) uint64 {
+	h := fnv.New64a()
+	writeHash(h, datum)
+	return h.Sum64()
+}
+
+func writeHash(h hash.Hash64, datum any) {
+	if entries, ok := dictEntries(datum); ok {
+		var sum uint64
+
+		for _, entry := range entries {
+			sum += Hash(entry[0])*31 + Hash(entry[1])
+		}
+
+		h.Write([]byte{'d'})
+		writeUint(h, sum)
+		return
+	}
+
+	if elems, ok := setElements(datum); ok {
+		var sum uint64
+
+		for _, elem := range elems {
+			sum += Hash(elem)
+		}
+
+		h.Write([]byte{'e'})
+		writeUint(h, sum)
+		return
+	}
+
+	switch v := datum.(type) {
+	case int:
+		h.Write([]byte{'i'})
+		writeUint(h, uint64(v))
+
+	case float64:
+		switch {
+		case v == 0:
+			v = 0
+
+		case math.IsNaN(v):
+			v = math.NaN()
+		}
+
+		h.Write([]byte{'f'})
+		writeUint(h, math.Float64bits(v))
+
+	case string:
+		h.Write([]byte{'s'})
+		writeUint(h, uint64(len(v)))
+		h.Write([]byte(v))
+
+	case Symbol:
+		h.Write([]byte{'y'})
+		writeUint(h, uint64(len(v)))
+		h.Write([]byte(v))
+
+	case []any:
+		h.Write([]byte{'l'})
+		writeUint(h, uint64(len(v)))
+
+		for _, elem := range v {
+			writeHash(h, elem)
+		}
+
+	case Pair:
+		h.Write([]byte{'p'})
+		writeHash(h, v.Car)
+		writeHash(h, v.Cdr)
+
+	case Tagged:
+		h.Write([]byte{'t'})
+		writeHash(h, v.Tag)
+		writeHash(h, v.Val)
+
+	default:
+		h.Write([]byte{'o'})
+		fmt.Fprintf(h, "%T", datum)
+	}
+}
+
+func writeUint(h hash.Hash64, n uint64) {
+	h.Write(binary.LittleEndian.AppendUint64(nil, n))
+}
+
+// dictEntries returns the entries of a dict. A (dict ...) form is only
+// treated as a dict if it is well formed, with atom keys and no duplicates.
+func dictEntries(datum any) ([][2]any, bool) {
+	switch m := datum.(type) {
+	case *Dict[any]:
+		entries := make([][2]any, 0, m.Len())
+
+		for k, v := range m.All() {
+			entries = append(entries, [2]any{k, v})
+		}
+
+		return entries, true
+
+	case map[any]any:
+		entries := make([][2]any, 0, len(m))
+
+		for k, v := range m {
+			entries = append(entries, [2]any{k, v})
+		}
+
+		return entries, true
+
+	case []any:
+		if len(m) == 0 || m[0] != Symbol("dict") || len(m)%2 == 0 {
+			return nil, false
+		}
+
+		entries := make([][2]any, 0, len(m)/2)
+		seen := make(map[any]bool, len(m)/2)
+
+		for i := 1; i < len(m); i += 2 {
+			if !isDictKey(m[i]) || seen[m[i]] {
+				return nil, false
+			}
+
+			seen[m[i]] = true
+			entries = append(entries, [2]any{m[i], m[i+1]})
+		}
+
+		return entries, true
+	}
+
+	return nil, false
+}
+
+func setElements(datum any) ([]any, bool) {
+	list, ok := datum.([]any)
+
+	if !ok || len(list) == 0 || list[0] != Symbol("set") {
+		return nil, false
+	}
+
+	return list[1:], true
+}
+
+func equalEntries(x, y [][2]any) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	sortEntries(x)
+	sortEntries(y)
+
+	for i := range x {
+		if !Equal(x[i][0], y[i][0]) || !Equal(x[i][1], y[i][1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalElements(x, y []any) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	x = slices.SortedFunc(slices.Values(x), Compare)
+	y = slices.SortedFunc(slices.Values(y), Compare)
+
+	for i := range x {
+		if !Equal(x[i], y[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortEntries(entries [][2]any) {
+	slices.SortFunc(entries, func(p, q [2]any) int {
+		return Compare(p[0], q[0])
+	})
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mowen132/macro"
+)
+
+var builtins = map[macro.Symbol]func(args []any) (any, error){
+	"+": func(args []any) (any, error) {
+		return fold(args, 0, func(a, b int) int { return a + b }, func(a, b float64) float64 { return a + b })
+	},
+	"-": func(args []any) (any, error) {
+		if len(args) == 1 {
+			args = []any{0, args[0]}
+		}
+
+		return fold1(args, func(a, b int) int { return a - b }, func(a, b float64) float64 { return a - b })
+	},
+	"*": func(args []any) (any, error) {
+		return fold(args, 1, func(a, b int) int { return a * b }, func(a, b float64) float64 { return a * b })
+	},
+	"/":             divide,
+	"mod":           mod,
+	"=":             compare(func(c int) bool { return c == 0 }),
+	"<":             compare(func(c int) bool { return c < 0 }),
+	">":             compare(func(c int) bool { return c > 0 }),
+	"<=":            compare(func(c int) bool { return c <= 0 }),
+	">=":            compare(func(c int) bool { return c >= 0 }),
+	"not":           not,
+	"equal?":        equal,
+	"list":          list,
+	"cons":          cons,
+	"car":           car,
+	"cdr":           cdr,
+	"length":        length,
+	"null?":         null,
+	"string-append": stringAppend,
+}
+
+var errDivideByZero = errors.New("division by zero")
+
+// fold combines numbers left to right, staying an int while every argument
+// is an int.
+func fold(args []any, zero int, ints func(a, b int) int, floats func(a, b float64) float64) (any, error) {
+	return fold1(append([]any{zero}, args...), ints, floats)
+}
+
+func fold1(args []any, ints func(a, b int) int, floats func(a, b float64) float64) (any, error) {
+	if len(args) == 0 {
+		return nil, errArity("at least 1", args)
+	}
+
+	acc := args[0]
+
+	if _, err := number(acc); err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args[1:] {
+		x, isInt := acc.(int)
+		y, ok := arg.(int)
+
+		if isInt && ok {
+			acc = ints(x, y)
+			continue
+		}
+
+		a, _ := number(acc)
+		b, err := number(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		acc = floats(a, b)
+	}
+
+	return acc, nil
+}
+
+// divide returns an int when every division is exact, and a float otherwise.
+func divide(args []any) (any, error) {
+	if len(args) == 1 {
+		args = []any{1, args[0]}
+	}
+
+	if len(args) == 0 {
+		return nil, errArity("at least 1", args)
+	}
+
+	acc := args[0]
+
+	if _, err := number(acc); err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args[1:] {
+		b, err := number(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if b == 0 {
+			return nil, errDivideByZero
+		}
+
+		x, isInt := acc.(int)
+		y, ok := arg.(int)
+
+		if isInt && ok && x%y == 0 {
+			acc = x / y
+			continue
+		}
+
+		a, _ := number(acc)
+		acc = a / b
+	}
+
+	return acc, nil
+}
+
+// mod returns the remainder with the sign of the divisor.
+func mod(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, errArity("2", args)
+	}
+
+	x, isInt := args[0].(int)
+	y, ok := args[1].(int)
+
+	if isInt && ok {
+		if y == 0 {
+			return nil, errDivideByZero
+		}
+
+		r := x % y
+
+		if r != 0 && (r < 0) != (y < 0) {
+			r += y
+		}
+
+		return r, nil
+	}
+
+	a, err := number(args[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := number(args[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b == 0 {
+		return nil, errDivideByZero
+	}
+
+	r := math.Mod(a, b)
+
+	if r != 0 && (r < 0) != (b < 0) {
+		r += b
+	}
+
+	return r, nil
+}
+
+// compare returns a builtin that holds when ok holds for each adjacent pair
+// of its arguments. Ints and floats compare by value, so (= 1 1.0) is true.
+func compare(ok func(c int) bool) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		if len(args) == 0 {
+			return nil, errArity("at least 1", args)
+		}
+
+		nums := make([]float64, len(args))
+
+		for i, arg := range args {
+			var err error
+
+			if nums[i], err = number(arg); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := 1; i < len(nums); i++ {
+			if !ok(cmp.Compare(nums[i-1], nums[i])) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+}
+
+func not(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errArity("1", args)
+	}
+
+	return !isTrue(args[0]), nil
+}
+
+func equal(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, errArity("2", args)
+	}
+
+	return macro.Equal(args[0], args[1]), nil
+}
+
+func list(args []any) (any, error) {
+	return append([]any{}, args...), nil
+}
+
+func cons(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, errArity("2", args)
+	}
+
+	if tail, ok := args[1].([]any); ok {
+		return append([]any{args[0]}, tail...), nil
+	}
+
+	return macro.Pair{Car: args[0], Cdr: args[1]}, nil
+}
+
+func car(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errArity("1", args)
+	}
+
+	switch v := args[0].(type) {
+	case []any:
+		if len(v) > 0 {
+			return v[0], nil
+		}
+
+	case macro.Pair:
+		return v.Car, nil
+	}
+
+	return nil, fmt.Errorf("expected non-empty list, got %s", describe(args[0]))
+}
+
+func cdr(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errArity("1", args)
+	}
+
+	switch v := args[0].(type) {
+	case []any:
+		if len(v) > 0 {
+			return v[1:], nil
+		}
+
+	case macro.Pair:
+		return v.Cdr, nil
+	}
+
+	return nil, fmt.Errorf("expected non-empty list, got %s", describe(args[0]))
+}
+
+func length(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errArity("1", args)
+	}
+
+	switch v := args[0].(type) {
+	case []any:
+		return len(v), nil
+
+	case string:
+		return len(v), nil
+	}
+
+	return nil, fmt.Errorf("expected list or string, got %s", describe(args[0]))
+}
+
+func null(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errArity("1", args)
+	}
+
+	l, ok := args[0].([]any)
+	return ok && len(l) == 0, nil
+}
+
+func stringAppend(args []any) (any, error) {
+	var b strings.Builder
+
+	for _, arg := range args {
+		s, ok := arg.(string)
+
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %s", describe(arg))
+		}
+
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+func number(val any) (float64, error) {
+	switch n := val.(type) {
+	case int:
+		return float64(n), nil
+
+	case float64:
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("expected number, got %s", describe(val))
+}
+
+func errArity(want string, args []any) error {
+	return fmt.Errorf("expected %s arguments, got %d", want, len(args))
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"github.com/mowen132/macro"
+)
+
+// Env is a scope mapping symbols to values, nested within a parent scope.
+type Env struct {
+	parent *Env
+	vars   map[macro.Symbol]any
+}
+
+func NewEnv(parent *Env) *Env {
+	return &Env{parent: parent, vars: map[macro.Symbol]any{}}
+}
+
+// Define binds name in e, replacing any binding of name in e itself.
+func (e *Env) Define(name macro.Symbol, val any) {
+	e.vars[name] = val
+}
+
+// Lookup returns the value bound to name in e or its ancestors.
+func (e *Env) Lookup(name macro.Symbol) (any, bool) {
+	for ; e != nil; e = e.parent {
+		if val, ok := e.vars[name]; ok {
+			return val, true
+		}
+	}
+
+	return nil, false
+}
+
+// set rebinds name in the nearest scope that binds it.
+func (e *Env) set(name macro.Symbol, val any) bool {
+	for ; e != nil; e = e.parent {
+		if _, ok := e.vars[name]; ok {
+			e.vars[name] = val
+			return true
+		}
+	}
+
+	return false
+}
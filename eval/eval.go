@@ -0,0 +1,329 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package eval is a small evaluator for S-expression DSLs, for computing
+// values in configuration such as (* 60 60).
+//
+// It evaluates ints, floats and strings to themselves, symbols to their
+// bindings, and lists as special forms or procedure calls. The special forms
+// are quote, if, define, set!, lambda, let (including named let), let*,
+// begin, and and or. The symbols true and false are bound to Go bools, and
+// false is the only false value. Procedures called in tail position do not
+// grow the Go stack, so loops may be written as recursion.
+//
+// The global environment provides arithmetic (+ - * / mod), comparison
+// (= < > <= >=), not, equal?, and list and string builtins (list cons car
+// cdr length null? string-append). Go functions are added with Register.
+//
+// NewWithOptions bounds the steps, depth and allocation of each evaluation
+// and restricts the builtins, for evaluating untrusted input.
+package eval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mowen132/macro"
+)
+
+// Procedure is a closure created by lambda or define.
+type Procedure struct {
+	Name   macro.Symbol
+	params []macro.Symbol
+	rest   macro.Symbol
+	body   []macro.Value
+	env    *Env
+}
+
+func (p *Procedure) String() string {
+	if p.Name == "" {
+		return "#<procedure>"
+	}
+
+	return fmt.Sprintf("#<procedure %s>", p.Name)
+}
+
+// Builtin is a procedure implemented in Go. Lists and strings it returns
+// count towards Options.MaxAlloc.
+type Builtin struct {
+	Name   macro.Symbol
+	Fn     func(args []any) (any, error)
+	shares bool
+}
+
+func (b *Builtin) String() string {
+	return fmt.Sprintf("#<builtin %s>", b.Name)
+}
+
+// Evaluator holds a global environment. It is not safe for concurrent use.
+type Evaluator struct {
+	opts    Options
+	global  *Env
+	running bool
+	ctx     context.Context
+	done    <-chan struct{}
+	steps   int
+	depth   int
+	alloc   int
+}
+
+// New returns an evaluator whose global environment holds the builtins.
+func New() *Evaluator {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(opts Options) *Evaluator {
+	ev := &Evaluator{opts: opts, global: NewEnv(nil)}
+	ev.global.Define("true", true)
+	ev.global.Define("false", false)
+
+	names := opts.Builtins
+
+	if names == nil {
+		for name := range builtins {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if fn, ok := builtins[name]; ok {
+			ev.global.Define(name, &Builtin{Name: name, Fn: fn, shares: sharing[name]})
+		}
+	}
+
+	return ev
+}
+
+// Global returns the global environment.
+func (ev *Evaluator) Global() *Env {
+	return ev.global
+}
+
+// Define binds name in the global environment.
+func (ev *Evaluator) Define(name macro.Symbol, val any) {
+	ev.global.Define(name, val)
+}
+
+// Eval evaluates v in the global environment.
+func (ev *Evaluator) Eval(v macro.Value) (any, error) {
+	return ev.EvalContext(context.Background(), v)
+}
+
+// EvalIn evaluates v in env.
+func (ev *Evaluator) EvalIn(env *Env, v macro.Value) (any, error) {
+	return ev.run(context.Background(), func() (any, error) {
+		return ev.eval(v, env)
+	})
+}
+
+// EvalContext evaluates v in the global environment, stopping with an error
+// wrapping the context's error when ctx is done.
+func (ev *Evaluator) EvalContext(ctx context.Context, v macro.Value) (any, error) {
+	return ev.run(ctx, func() (any, error) {
+		return ev.eval(v, ev.global)
+	})
+}
+
+// Apply calls a procedure or builtin with args.
+func (ev *Evaluator) Apply(fn any, args ...any) (any, error) {
+	return ev.run(context.Background(), func() (any, error) {
+		switch f := fn.(type) {
+		case *Builtin:
+			return f.Fn(args)
+
+		case *Procedure:
+			env, err := f.bind(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return ev.body(f.body, env)
+		}
+
+		return nil, fmt.Errorf("cannot call %s", describe(fn))
+	})
+}
+
+func (ev *Evaluator) eval(v macro.Value, env *Env) (any, error) {
+	if err := ev.enter(v.Pos); err != nil {
+		return nil, err
+	}
+
+	defer ev.leave()
+
+	for {
+		if err := ev.step(v.Pos); err != nil {
+			return nil, err
+		}
+
+		switch datum := v.Datum.(type) {
+		case macro.Symbol:
+			val, ok := env.Lookup(datum)
+
+			if !ok {
+				return nil, fmt.Errorf("%s unbound symbol %s", v.Pos, datum)
+			}
+
+			return val, nil
+
+		case macro.Pair:
+			return nil, fmt.Errorf("%s cannot evaluate dotted pair", v.Pos)
+
+		case []any:
+			// handled below
+
+		default:
+			return datum, nil
+		}
+
+		items, _ := v.List()
+
+		if len(items) == 0 {
+			return nil, fmt.Errorf("%s cannot evaluate empty list", v.Pos)
+		}
+
+		if head, ok := items[0].Datum.(macro.Symbol); ok && special[head] {
+			next, nextEnv, val, err := ev.evalForm(head, v, items[1:], env)
+
+			if err != nil || next == nil {
+				return val, err
+			}
+
+			v, env = *next, nextEnv
+			continue
+		}
+
+		fn, err := ev.eval(items[0], env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args := make([]any, len(items)-1)
+
+		for i, item := range items[1:] {
+			if args[i], err = ev.eval(item, env); err != nil {
+				return nil, err
+			}
+		}
+
+		switch f := fn.(type) {
+		case *Builtin:
+			val, err := f.Fn(args)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", v.Pos, f.Name, err)
+			}
+
+			if !f.shares {
+				if err := ev.charge(v.Pos, size(val)); err != nil {
+					return nil, err
+				}
+			}
+
+			return val, nil
+
+		case *Procedure:
+			if env, err = f.bind(args); err != nil {
+				return nil, fmt.Errorf("%s %w", v.Pos, err)
+			}
+
+			if err := ev.charge(v.Pos, len(args)); err != nil {
+				return nil, err
+			}
+
+			if len(f.body) == 0 {
+				return nil, nil
+			}
+
+			for _, form := range f.body[:len(f.body)-1] {
+				if _, err := ev.eval(form, env); err != nil {
+					return nil, err
+				}
+			}
+
+			v = f.body[len(f.body)-1]
+
+		default:
+			return nil, fmt.Errorf("%s cannot call %s", v.Pos, describe(fn))
+		}
+	}
+}
+
+// body evaluates a sequence of forms, returning the value of the last.
+func (ev *Evaluator) body(forms []macro.Value, env *Env) (any, error) {
+	var val any
+
+	for _, form := range forms {
+		var err error
+
+		if val, err = ev.eval(form, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return val, nil
+}
+
+func (p *Procedure) bind(args []any) (*Env, error) {
+	if len(args) < len(p.params) || p.rest == "" && len(args) > len(p.params) {
+		want := fmt.Sprint(len(p.params))
+
+		if p.rest != "" {
+			want = "at least " + want
+		}
+
+		return nil, fmt.Errorf("%s expected %s arguments, got %d", p, want, len(args))
+	}
+
+	env := NewEnv(p.env)
+
+	for i, param := range p.params {
+		env.Define(param, args[i])
+	}
+
+	if p.rest != "" {
+		env.Define(p.rest, append([]any{}, args[len(p.params):]...))
+	}
+
+	return env, nil
+}
+
+func isTrue(val any) bool {
+	b, ok := val.(bool)
+	return !ok || b
+}
+
+func describe(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return "nothing"
+
+	case int:
+		return "int"
+
+	case float64:
+		return "float"
+
+	case string:
+		return "string"
+
+	case macro.Symbol:
+		return "symbol"
+
+	case bool:
+		return "bool"
+
+	case []any:
+		return "list"
+
+	case macro.Pair:
+		return "pair"
+
+	case *Procedure, *Builtin:
+		return fmt.Sprint(v)
+	}
+
+	return fmt.Sprintf("%T", val)
+}
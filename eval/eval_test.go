@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mowen132/macro"
+)
+
+// run evaluates the forms of src in order, returning the value of the last.
+func run(ctx context.Context, ev *Evaluator, src string) (any, error) {
+	d := macro.NewDecoder(strings.NewReader(src))
+	var val any
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return val, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if val, err = ev.EvalContext(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"(* 60 60)", 3600},
+		{"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1))))) (fact 10)", 3628800},
+		{"(let loop ((i 0) (acc 0)) (if (= i 100000) acc (loop (+ i 1) (+ acc i))))", 4999950000},
+		{"(define (f . xs) xs) (f 1 2)", []any{1, 2}},
+		{"(let* ((x 1) (y (+ x 1))) (list x y))", []any{1, 2}},
+		{`(string-append "a" "b")`, "ab"},
+		{"(and 1 false 2)", false},
+		{"(or false 2)", 2},
+		{"(define x 1) (set! x 2) x", 2},
+		{"'(a . b)", macro.Pair{Car: macro.Symbol("a"), Cdr: macro.Symbol("b")}},
+	}
+
+	for _, test := range tests {
+		got, err := run(context.Background(), New(), test.src)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+
+		if !macro.Equal(got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x", "[1:1] unbound symbol x"},
+		{"()", "[1:1] cannot evaluate empty list"},
+		{"(1 2)", "[1:1] cannot call int"},
+		{"(set! y 1)", "[1:7] unbound symbol y"},
+		{"(if)", "[1:1] expected (if test then [else])"},
+		{"(define (f x) x) (f)", "[1:18] #<procedure f> expected 1 arguments, got 0"},
+		{"(lambda (1) 1)", "[1:9] expected parameter name, got int"},
+		{"(let ((x)) x)", "[1:7] expected (name expr)"},
+		{"(car 1)", "[1:1] car:"},
+		{"'(a . b) (eval-me)", "[1:11] unbound symbol eval-me"},
+	}
+
+	for _, test := range tests {
+		_, err := run(context.Background(), New(), test.src)
+
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	ev := NewWithOptions(Options{Builtins: []macro.Symbol{"+"}})
+
+	if _, err := run(context.Background(), ev, "(* 2 3)"); err == nil || err.Error() != "[1:2] unbound symbol *" {
+		t.Errorf("(* 2 3) without * = %v, want unbound symbol", err)
+	}
+
+	if got, err := run(context.Background(), ev, "(+ 2 3)"); err != nil || got != 5 {
+		t.Errorf("(+ 2 3) = %v, %v, want 5", got, err)
+	}
+}
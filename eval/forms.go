@@ -0,0 +1,370 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"fmt"
+
+	"github.com/mowen132/macro"
+)
+
+var special = map[macro.Symbol]bool{
+	"quote":  true,
+	"if":     true,
+	"define": true,
+	"set!":   true,
+	"lambda": true,
+	"let":    true,
+	"let*":   true,
+	"begin":  true,
+	"and":    true,
+	"or":     true,
+}
+
+// evalForm evaluates a special form. It either returns a value, or the form
+// in tail position and its environment, for eval to continue with.
+func (ev *Evaluator) evalForm(head macro.Symbol, v macro.Value, args []macro.Value, env *Env) (*macro.Value, *Env, any, error) {
+	switch head {
+	case "quote":
+		if len(args) != 1 {
+			return nil, nil, nil, fmt.Errorf("%s expected (quote datum)", v.Pos)
+		}
+
+		return nil, nil, args[0].Datum, nil
+
+	case "if":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, nil, nil, fmt.Errorf("%s expected (if test then [else])", v.Pos)
+		}
+
+		test, err := ev.eval(args[0], env)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if isTrue(test) {
+			return &args[1], env, nil, nil
+		}
+
+		if len(args) == 3 {
+			return &args[2], env, nil, nil
+		}
+
+		return nil, nil, nil, nil
+
+	case "define":
+		return ev.define(v, args, env)
+
+	case "set!":
+		if len(args) != 2 {
+			return nil, nil, nil, fmt.Errorf("%s expected (set! name expr)", v.Pos)
+		}
+
+		name, err := args[0].AsSymbol()
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		val, err := ev.eval(args[1], env)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if !env.set(name, val) {
+			return nil, nil, nil, fmt.Errorf("%s unbound symbol %s", args[0].Pos, name)
+		}
+
+		return nil, nil, val, nil
+
+	case "lambda":
+		if len(args) < 1 {
+			return nil, nil, nil, fmt.Errorf("%s expected (lambda params body ...)", v.Pos)
+		}
+
+		p, err := newProcedure("", args[0], args[1:], env)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return nil, nil, p, ev.charge(v.Pos, 1)
+
+	case "let":
+		return ev.let(v, args, env)
+
+	case "let*":
+		if len(args) < 1 {
+			return nil, nil, nil, fmt.Errorf("%s expected (let* ((name expr) ...) body ...)", v.Pos)
+		}
+
+		bindings, err := parseBindings(args[0])
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if err := ev.charge(v.Pos, len(bindings)); err != nil {
+			return nil, nil, nil, err
+		}
+
+		for _, b := range bindings {
+			val, err := ev.eval(b.expr, env)
+
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			env = NewEnv(env)
+			env.Define(b.name, val)
+		}
+
+		return ev.tail(args[1:], env)
+
+	case "begin":
+		return ev.tail(args, env)
+
+	case "and", "or":
+		if len(args) == 0 {
+			return nil, nil, head == "and", nil
+		}
+
+		for _, arg := range args[:len(args)-1] {
+			val, err := ev.eval(arg, env)
+
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			if isTrue(val) != (head == "and") {
+				return nil, nil, val, nil
+			}
+		}
+
+		return &args[len(args)-1], env, nil, nil
+	}
+
+	return nil, nil, nil, fmt.Errorf("%s unknown special form %s", v.Pos, head)
+}
+
+// tail evaluates all but the last of a sequence of forms, returning the last
+// to be evaluated in tail position.
+func (ev *Evaluator) tail(forms []macro.Value, env *Env) (*macro.Value, *Env, any, error) {
+	if len(forms) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	for _, form := range forms[:len(forms)-1] {
+		if _, err := ev.eval(form, env); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return &forms[len(forms)-1], env, nil, nil
+}
+
+// define handles (define name expr) and (define (name params ...) body ...).
+func (ev *Evaluator) define(v macro.Value, args []macro.Value, env *Env) (*macro.Value, *Env, any, error) {
+	if len(args) < 1 {
+		return nil, nil, nil, fmt.Errorf("%s expected (define name expr)", v.Pos)
+	}
+
+	if name, ok := args[0].Datum.(macro.Symbol); ok {
+		if len(args) != 2 {
+			return nil, nil, nil, fmt.Errorf("%s expected (define name expr)", v.Pos)
+		}
+
+		val, err := ev.eval(args[1], env)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if p, ok := val.(*Procedure); ok && p.Name == "" {
+			p.Name = name
+		}
+
+		if err := ev.charge(v.Pos, 1); err != nil {
+			return nil, nil, nil, err
+		}
+
+		env.Define(name, val)
+		return nil, nil, name, nil
+	}
+
+	var name, params macro.Value
+
+	switch sig := args[0].Datum.(type) {
+	case []any:
+		items, _ := args[0].List()
+
+		if len(items) == 0 {
+			return nil, nil, nil, fmt.Errorf("%s expected procedure name", args[0].Pos)
+		}
+
+		name, params = items[0], args[0].DeriveList(items[1:]...)
+
+	case macro.Pair:
+		name, params = args[0].Derive(sig.Car), args[0].Derive(sig.Cdr)
+
+	default:
+		return nil, nil, nil, fmt.Errorf("%s expected name or (name params ...), got %s", args[0].Pos, describe(sig))
+	}
+
+	sym, err := name.AsSymbol()
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p, err := newProcedure(sym, params, args[1:], env)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := ev.charge(v.Pos, 2); err != nil {
+		return nil, nil, nil, err
+	}
+
+	env.Define(sym, p)
+	return nil, nil, sym, nil
+}
+
+// let handles (let ((name expr) ...) body ...) and the named let
+// (let loop ((name expr) ...) body ...), which binds loop to a procedure
+// taking the names as parameters and calls it with the initial values.
+func (ev *Evaluator) let(v macro.Value, args []macro.Value, env *Env) (*macro.Value, *Env, any, error) {
+	var loop macro.Symbol
+
+	if len(args) > 0 {
+		if sym, ok := args[0].Datum.(macro.Symbol); ok {
+			loop, args = sym, args[1:]
+		}
+	}
+
+	if len(args) < 1 {
+		return nil, nil, nil, fmt.Errorf("%s expected (let ((name expr) ...) body ...)", v.Pos)
+	}
+
+	bindings, err := parseBindings(args[0])
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := ev.charge(v.Pos, len(bindings)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	inner := NewEnv(env)
+
+	for _, b := range bindings {
+		val, err := ev.eval(b.expr, env)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		inner.Define(b.name, val)
+	}
+
+	if loop != "" {
+		p := &Procedure{Name: loop, body: args[1:]}
+
+		for _, b := range bindings {
+			p.params = append(p.params, b.name)
+		}
+
+		p.env = NewEnv(env)
+		p.env.Define(loop, p)
+		inner.parent = p.env
+	}
+
+	return ev.tail(args[1:], inner)
+}
+
+type binding struct {
+	name macro.Symbol
+	expr macro.Value
+}
+
+func parseBindings(v macro.Value) ([]binding, error) {
+	items, err := v.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]binding, len(items))
+
+	for i, item := range items {
+		pair, err := item.List()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("%s expected (name expr)", item.Pos)
+		}
+
+		name, err := pair[0].AsSymbol()
+
+		if err != nil {
+			return nil, err
+		}
+
+		bindings[i] = binding{name, pair[1]}
+	}
+
+	return bindings, nil
+}
+
+// newProcedure parses a parameter list: a list of symbols, a dotted list
+// whose tail names the rest parameter, or a single symbol naming them all.
+func newProcedure(name macro.Symbol, params macro.Value, body []macro.Value, env *Env) (*Procedure, error) {
+	p := &Procedure{Name: name, body: body, env: env}
+	datum := params.Datum
+
+	for {
+		pair, ok := datum.(macro.Pair)
+
+		if !ok {
+			break
+		}
+
+		sym, ok := pair.Car.(macro.Symbol)
+
+		if !ok {
+			return nil, fmt.Errorf("%s expected parameter name, got %s", params.Pos, describe(pair.Car))
+		}
+
+		p.params = append(p.params, sym)
+		datum = pair.Cdr
+	}
+
+	switch d := datum.(type) {
+	case macro.Symbol:
+		p.rest = d
+
+	case []any:
+		for _, param := range d {
+			sym, ok := param.(macro.Symbol)
+
+			if !ok {
+				return nil, fmt.Errorf("%s expected parameter name, got %s", params.Pos, describe(param))
+			}
+
+			p.params = append(p.params, sym)
+		}
+
+	default:
+		return nil, fmt.Errorf("%s expected parameter list, got %s", params.Pos, describe(datum))
+	}
+
+	return p, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mowen132/macro"
+)
+
+// Options bound the resources an evaluation may use, for evaluating
+// untrusted input. Each call to Eval, EvalContext or Apply starts with fresh
+// counts; a limit of zero is unlimited. Exceeding a limit returns a
+// *macro.LimitError carrying the position of the form being evaluated.
+type Options struct {
+	// MaxSteps limits the number of forms evaluated, including each
+	// iteration of a loop written as a tail call.
+	MaxSteps int
+
+	// MaxDepth limits the nesting of evaluation, such as non-tail recursive
+	// calls. Without it deep recursion can exhaust the Go stack.
+	MaxDepth int
+
+	// MaxAlloc limits the values allocated: one per variable bound and
+	// procedure created, and the length of every list and string built by a
+	// builtin.
+	MaxAlloc int
+
+	// Builtins lists the builtins bound in the global environment. When nil
+	// all builtins are bound. Functions added with Register are always bound.
+	Builtins []macro.Symbol
+}
+
+// sharing lists the builtins whose results share storage with their
+// arguments, so do not count towards MaxAlloc.
+var sharing = map[macro.Symbol]bool{
+	"car": true,
+	"cdr": true,
+}
+
+// run calls f with fresh limit counts, unless an evaluation is already
+// running, as when a registered function calls back into the evaluator.
+func (ev *Evaluator) run(ctx context.Context, f func() (any, error)) (any, error) {
+	if ev.running {
+		return f()
+	}
+
+	ev.running, ev.ctx, ev.done = true, ctx, ctx.Done()
+	ev.steps, ev.depth, ev.alloc = 0, 0, 0
+
+	defer func() {
+		ev.running, ev.ctx, ev.done = false, nil, nil
+	}()
+
+	return f()
+}
+
+// step counts a form evaluated at pos and checks for cancellation.
+func (ev *Evaluator) step(pos macro.Position) error {
+	select {
+	case <-ev.done:
+		return fmt.Errorf("%s %w", pos, context.Cause(ev.ctx))
+
+	default:
+	}
+
+	if ev.steps++; ev.opts.MaxSteps > 0 && ev.steps > ev.opts.MaxSteps {
+		return &macro.LimitError{Limit: "step count", Max: ev.opts.MaxSteps, Pos: pos}
+	}
+
+	return nil
+}
+
+func (ev *Evaluator) enter(pos macro.Position) error {
+	if ev.depth++; ev.opts.MaxDepth > 0 && ev.depth > ev.opts.MaxDepth {
+		ev.depth--
+		return &macro.LimitError{Limit: "evaluation depth", Max: ev.opts.MaxDepth, Pos: pos}
+	}
+
+	return nil
+}
+
+func (ev *Evaluator) leave() {
+	ev.depth--
+}
+
+// charge counts n values allocated by the form at pos.
+func (ev *Evaluator) charge(pos macro.Position, n int) error {
+	if ev.alloc += n; ev.opts.MaxAlloc > 0 && ev.alloc > ev.opts.MaxAlloc {
+		return &macro.LimitError{Limit: "allocation", Max: ev.opts.MaxAlloc, Pos: pos}
+	}
+
+	return nil
+}
+
+// size returns the number of values charged for a builtin's result.
+func size(val any) int {
+	switch v := val.(type) {
+	case []any:
+		return len(v)
+
+	case string:
+		return len(v)
+
+	case macro.Pair:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mowen132/macro"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		opts  Options
+		src   string
+		limit string
+	}{
+		{Options{MaxSteps: 1000}, "(define (f) (f)) (f)", "step count"},
+		{Options{MaxDepth: 100}, "(define (f n) (+ 1 (f n))) (f 0)", "evaluation depth"},
+		{Options{MaxAlloc: 100}, "(define (f l) (f (cons 1 l))) (f '())", "allocation"},
+		{Options{MaxAlloc: 100}, `(define (f s) (f (string-append s s))) (f "ab")`, "allocation"},
+	}
+
+	for _, test := range tests {
+		_, err := run(context.Background(), NewWithOptions(test.opts), test.src)
+		var limit *macro.LimitError
+
+		if !errors.As(err, &limit) || limit.Limit != test.limit || limit.Pos.Line != 1 {
+			t.Errorf("%s: got error %v, want %s limit", test.src, err, test.limit)
+		}
+	}
+}
+
+func TestLimitsReset(t *testing.T) {
+	ev := NewWithOptions(Options{MaxSteps: 100})
+
+	if _, err := run(context.Background(), ev, "(define (count n) (if (= n 0) 0 (count (- n 1))))"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each evaluation starts with a fresh step count.
+	for range 10 {
+		if _, err := run(context.Background(), ev, "(count 5)"); err != nil {
+			t.Fatalf("(count 5): %v", err)
+		}
+	}
+
+	if _, err := run(context.Background(), ev, "(count 100)"); err == nil {
+		t.Error("(count 100) succeeded, want step limit")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := run(ctx, New(), "(define (f) (f)) (f)")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want deadline exceeded", err)
+	}
+}
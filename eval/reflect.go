@@ -0,0 +1,233 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/mowen132/macro"
+)
+
+var errorType = reflect.TypeFor[error]()
+
+// Register binds name in the global environment to a builtin calling the Go
+// function fn. Arguments are converted to fn's parameter types: numbers
+// convert between kinds when no precision is lost, and lists convert to
+// slices element by element. Variadic functions take the trailing arguments.
+// fn may return nothing, a value, an error, or a value and an error; numbers
+// and slices in the result are converted back to int, float64 and lists.
+func (ev *Evaluator) Register(name macro.Symbol, fn any) error {
+	f := reflect.ValueOf(fn)
+
+	if f.Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %T as %s: not a function", fn, name)
+	}
+
+	t := f.Type()
+
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType:
+		return fmt.Errorf("cannot register %T as %s: results must be (), (T), (error) or (T, error)", fn, name)
+	}
+
+	ev.global.Define(name, &Builtin{Name: name, Fn: func(args []any) (any, error) {
+		in, err := convertArgs(t, args)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return results(f.Call(in))
+	}})
+
+	return nil
+}
+
+func convertArgs(t reflect.Type, args []any) ([]reflect.Value, error) {
+	n := t.NumIn()
+
+	if t.IsVariadic() {
+		if len(args) < n-1 {
+			return nil, errArity(fmt.Sprintf("at least %d", n-1), args)
+		}
+	} else if len(args) != n {
+		return nil, errArity(fmt.Sprint(n), args)
+	}
+
+	in := make([]reflect.Value, len(args))
+
+	for i, arg := range args {
+		var pt reflect.Type
+
+		if t.IsVariadic() && i >= n-1 {
+			pt = t.In(n - 1).Elem()
+		} else {
+			pt = t.In(i)
+		}
+
+		v, err := convert(arg, pt)
+
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+
+		in[i] = v
+	}
+
+	return in, nil
+}
+
+// convert returns val as a value of type t.
+func convert(val any, t reflect.Type) (reflect.Value, error) {
+	if val == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	} else if v := reflect.ValueOf(val); v.Type().AssignableTo(t) {
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := exactInt(val)
+
+		if !ok || reflect.Zero(t).OverflowInt(n) {
+			break
+		}
+
+		return reflect.ValueOf(n).Convert(t), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := exactInt(val)
+
+		if !ok || n < 0 || reflect.Zero(t).OverflowUint(uint64(n)) {
+			break
+		}
+
+		return reflect.ValueOf(uint64(n)).Convert(t), nil
+
+	case reflect.Float32, reflect.Float64:
+		f, err := number(val)
+
+		if err != nil {
+			break
+		}
+
+		if n, ok := val.(int); ok {
+			if m, ok := exactInt(f); !ok || m != int64(n) {
+				break
+			}
+		}
+
+		if t.Kind() == reflect.Float32 && float64(float32(f)) != f && !math.IsNaN(f) {
+			break
+		}
+
+		return reflect.ValueOf(f).Convert(t), nil
+
+	case reflect.String:
+		if s, ok := val.(macro.Symbol); ok {
+			return reflect.ValueOf(string(s)).Convert(t), nil
+		}
+
+	case reflect.Slice:
+		list, ok := val.([]any)
+
+		if !ok {
+			break
+		}
+
+		s := reflect.MakeSlice(t, len(list), len(list))
+
+		for i, elem := range list {
+			v, err := convert(elem, t.Elem())
+
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+
+			s.Index(i).Set(v)
+		}
+
+		return s, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", describe(val), t)
+}
+
+func exactInt(val any) (int64, bool) {
+	switch n := val.(type) {
+	case int:
+		return int64(n), true
+
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+
+	return 0, false
+}
+
+// results converts the results of a registered function.
+func results(out []reflect.Value) (any, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	return normalize(out[0])
+}
+
+// normalize returns integers as int, floats as float64 and typed slices as
+// lists, the types the evaluator computes with. Unsigned integers too large
+// for an int are an error.
+func normalize(v reflect.Value) (any, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt {
+			return nil, fmt.Errorf("result %d overflows int", v.Uint())
+		}
+
+		return int(v.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Interface {
+			break
+		}
+
+		list := make([]any, v.Len())
+
+		for i := range list {
+			elem, err := normalize(v.Index(i))
+
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+
+			list[i] = elem
+		}
+
+		return list, nil
+	}
+
+	return v.Interface(), nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mowen132/macro"
+)
+
+func TestRegister(t *testing.T) {
+	ev := New()
+	register := func(name macro.Symbol, fn any) {
+		if err := ev.Register(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	register("upper", strings.ToUpper)
+	register("sum", func(xs ...int8) int8 {
+		var n int8
+
+		for _, x := range xs {
+			n += x
+		}
+
+		return n
+	})
+	register("half", func(x float32) float32 { return x / 2 })
+	register("double", func(x float64) float64 { return x * 2 })
+	register("big", func() uint64 { return math.MaxUint64 })
+	register("bigs", func() []uint64 { return []uint64{1, math.MaxUint64} })
+	register("fail", func() (int, error) { return 0, errors.New("failed") })
+	register("words", strings.Fields)
+
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`(upper "abc")`, "ABC"},
+		{"(upper 'abc)", "ABC"},
+		{"(sum 1 2 3)", 6},
+		{"(half 3)", 1.5},
+		{"(half 0.5)", 0.25},
+		{"(double 3)", 6.0},
+		{`(words "a b")`, []any{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		got, err := run(context.Background(), ev, test.src)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+
+		if !macro.Equal(got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.src, got, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		src  string
+		want string
+	}{
+		{"(sum 1 200)", "[1:1] sum: argument 2: cannot use int as int8"},
+		{"(sum 1.5)", "[1:1] sum: argument 1: cannot use float as int8"},
+		{"(half 0.1)", "[1:1] half: argument 1: cannot use float as float32"},
+		{"(double 9007199254740993)", "[1:1] double: argument 1: cannot use int as float64"},
+		{"(upper)", "[1:1] upper: expected 1 arguments, got 0"},
+		{"(big)", "[1:1] big: result 18446744073709551615 overflows int"},
+		{"(bigs)", "[1:1] bigs: element 1: result 18446744073709551615 overflows int"},
+		{"(fail)", "[1:1] fail: failed"},
+	}
+
+	for _, test := range errorTests {
+		_, err := run(context.Background(), ev, test.src)
+
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+
+	if err := ev.Register("x", 1); err == nil {
+		t.Error("Register(1) succeeded, want error")
+	}
+
+	if err := ev.Register("x", func() (int, int) { return 0, 0 }); err == nil {
+		t.Error("Register(func() (int, int)) succeeded, want error")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package expand implements hygienic syntax-rules macros over decoded
+// S-expressions:
+//
+//	(define-syntax swap!
+//	  (syntax-rules ()
+//	    ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp)))))
+//
+// Expansion works on Syntax, which records the marks of the expansion steps
+// that introduced each identifier. Once macros are expanded, identifiers a
+// template introduces and binds, such as tmp above, are renamed with
+// macro.Gensym, so they cannot capture identifiers the user wrote. Local
+// bindings the user wrote are likewise renamed when a template refers to a
+// free identifier of the same name, so that template references cannot be
+// captured either.
+//
+// The binding forms recognized are lambda, let (including named let), let*,
+// letrec, letrec* and define. Data inside quote, and inside quasiquote
+// outside unquote, are neither expanded nor renamed.
+package expand
+
+import (
+	"fmt"
+
+	"github.com/mowen132/macro"
+)
+
+// Options bound the work of each call to Expand or ExpandSyntax, so that a
+// macro that expands to a use of itself fails rather than looping. A limit
+// of zero is unlimited. Exceeding a limit returns a *macro.LimitError
+// carrying the position of the macro use being expanded.
+type Options struct {
+	// MaxSteps limits the number of macro uses expanded.
+	MaxSteps int
+
+	// MaxDepth limits the nesting of the lists being expanded, including
+	// those built by expansion.
+	MaxDepth int
+}
+
+type Expander struct {
+	opts    Options
+	macros  map[macro.Symbol]*rules
+	marks   Mark
+	steps   int
+	nesting int
+}
+
+// NewExpander returns an expander limited to 100000 expansion steps and a
+// nesting depth of 10000.
+func NewExpander() *Expander {
+	return NewExpanderWithOptions(Options{MaxSteps: 100_000, MaxDepth: 10_000})
+}
+
+func NewExpanderWithOptions(opts Options) *Expander {
+	return &Expander{opts: opts, macros: map[macro.Symbol]*rules{}}
+}
+
+// Define defines a macro from a (syntax-rules ...) specification.
+func (x *Expander) Define(name macro.Symbol, spec macro.Value) error {
+	r, err := compileRules(name, FromValue(spec))
+
+	if err != nil {
+		return err
+	}
+
+	x.macros[name] = r
+	return nil
+}
+
+// Expand expands the macros in a sequence of top-level forms and renames
+// identifiers for hygiene. A (define-syntax name (syntax-rules ...)) form,
+// at top level or within any list, defines a macro for the rest of the
+// expansion and is removed from the output.
+func (x *Expander) Expand(forms ...macro.Value) ([]macro.Value, error) {
+	list := make([]Syntax, len(forms))
+
+	for i, form := range forms {
+		list[i] = FromValue(form)
+	}
+
+	x.steps, x.nesting = 0, 0
+	expanded, err := x.expandList(list, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resolve(expanded), nil
+}
+
+// ExpandSyntax expands the macros in a single form, without renaming, and
+// returns the marked result.
+func (x *Expander) ExpandSyntax(s Syntax) (Syntax, error) {
+	x.steps, x.nesting = 0, 0
+	return x.expand(s, 0)
+}
+
+// expand expands s until it is no longer a macro use, then expands its
+// elements. Inside quasiquote, depth counts the enclosing quasiquotes not
+// cancelled by unquote.
+func (x *Expander) expand(s Syntax, depth int) (Syntax, error) {
+	for {
+		list, ok := s.List()
+
+		if !ok || len(list) == 0 {
+			return s, nil
+		}
+
+		head := s.head()
+
+		switch head {
+		case "quote", "define-syntax":
+			return s, nil
+
+		case "quasiquote":
+			return x.expandElements(s, list, depth+1)
+
+		case "unquote":
+			if depth > 0 {
+				return x.expandElements(s, list, depth-1)
+			}
+		}
+
+		r, ok := x.macros[head]
+
+		if !ok || depth > 0 {
+			return x.expandElements(s, list, depth)
+		}
+
+		if x.steps++; x.opts.MaxSteps > 0 && x.steps > x.opts.MaxSteps {
+			return Syntax{}, &macro.LimitError{Limit: "expansion step count", Max: x.opts.MaxSteps, Pos: s.Pos}
+		}
+
+		x.marks++
+		expanded, err := r.apply(s, x.marks)
+
+		if err != nil {
+			return Syntax{}, err
+		}
+
+		s = expanded
+	}
+}
+
+func (x *Expander) expandElements(s Syntax, list []Syntax, depth int) (Syntax, error) {
+	if x.opts.MaxDepth > 0 && x.nesting >= x.opts.MaxDepth {
+		return Syntax{}, &macro.LimitError{Limit: "expansion depth", Max: x.opts.MaxDepth, Pos: s.Pos}
+	}
+
+	x.nesting++
+	elems, err := x.expandList(list, depth)
+	x.nesting--
+
+	if err != nil {
+		return Syntax{}, err
+	}
+
+	s.Datum = elems
+	return s, nil
+}
+
+// expandList expands the elements of a list, defining and removing those
+// that are, or expand to, define-syntax forms.
+func (x *Expander) expandList(list []Syntax, depth int) ([]Syntax, error) {
+	elems := make([]Syntax, 0, len(list))
+
+	for _, elem := range list {
+		expanded, err := x.expand(elem, depth)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if depth == 0 && expanded.head() == "define-syntax" {
+			if err := x.defineSyntax(expanded); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		elems = append(elems, expanded)
+	}
+
+	return elems, nil
+}
+
+func (x *Expander) defineSyntax(s Syntax) error {
+	list, _ := s.List()
+
+	if len(list) != 3 {
+		return fmt.Errorf("%s expected (define-syntax name (syntax-rules ...))", s.Pos)
+	}
+
+	name, ok := list[1].Identifier()
+
+	if !ok {
+		return fmt.Errorf("%s expected macro name", list[1].Pos)
+	}
+
+	r, err := compileRules(name, list[2])
+
+	if err != nil {
+		return err
+	}
+
+	x.macros[name] = r
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package expand
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/eval"
+)
+
+func decode(t *testing.T, src string) []macro.Value {
+	t.Helper()
+	d := macro.NewDecoder(strings.NewReader(src))
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return forms
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forms = append(forms, v)
+	}
+}
+
+// evaluate expands and evaluates the forms of src, returning the value of
+// the last.
+func evaluate(t *testing.T, src string) any {
+	t.Helper()
+	forms, err := NewExpander().Expand(decode(t, src)...)
+
+	if err != nil {
+		t.Fatalf("Expand(%s): %v", src, err)
+	}
+
+	ev := eval.New()
+	var val any
+
+	for _, form := range forms {
+		if val, err = ev.Eval(form); err != nil {
+			t.Fatalf("Eval(%s): %v", src, err)
+		}
+	}
+
+	return val
+}
+
+func TestHygiene(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{"introduced binding", `
+			(define-syntax swap!
+			  (syntax-rules ()
+			    ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp)))))
+			(let ((tmp 1) (y 2)) (swap! tmp y) (list tmp y))
+		`, []any{2, 1}},
+		{"captured variable", `
+			(define-syntax my-or
+			  (syntax-rules ()
+			    ((_ a b) (let ((t a)) (if t t b)))))
+			(let ((t 5)) (my-or false t))
+		`, 5},
+		{"shadowed free identifier", `
+			(define-syntax one
+			  (syntax-rules ()
+			    ((_ x) (list x))))
+			(let ((list 0)) (one 1))
+		`, []any{1}},
+		{"ellipsis and literals", `
+			(define-syntax my-cond
+			  (syntax-rules (else)
+			    ((_ (else e)) e)
+			    ((_ (c e) rest ...) (if c e (my-cond rest ...)))))
+			(my-cond (false 1) ((= 1 2) 2) (else 3))
+		`, 3},
+		{"quoted data", `
+			(define-syntax q
+			  (syntax-rules ()
+			    ((_ x) '(x tmp))))
+			(q a)
+		`, []any{macro.Symbol("a"), macro.Symbol("tmp")}},
+	}
+
+	for _, test := range tests {
+		if got := evaluate(t, test.src); !macro.Equal(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"(define-syntax m)", "[1:1] expected (define-syntax name (syntax-rules ...))"},
+		{"(define-syntax 1 (syntax-rules ()))", "[1:16] expected macro name"},
+		{"(define-syntax m (syntax-rules () ((_ x x) x)))", "duplicate pattern variable x"},
+		{"(define-syntax m (syntax-rules () ((_ x ...) x)))\n(m 1)", "pattern variable x used without ellipsis"},
+		{"(define-syntax m (syntax-rules () ((_) 1)))\n(m 1)", "[2:1] no syntax-rules clause of m matches"},
+	}
+
+	for _, test := range tests {
+		_, err := NewExpander().Expand(decode(t, test.src)...)
+
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestExpandLimits(t *testing.T) {
+	tests := []struct {
+		src   string
+		limit string
+	}{
+		{"(define-syntax m (syntax-rules () ((_) (m))))\n  (m)", "expansion step count"},
+		{"(define-syntax m (syntax-rules () ((_ x) (m (m x)))))\n  (m 1)", "expansion step count"},
+		{"(define-syntax m (syntax-rules () ((_) (list (m)))))\n  (m)", "expansion depth"},
+	}
+
+	for _, test := range tests {
+		_, err := NewExpanderWithOptions(Options{MaxSteps: 1000, MaxDepth: 100}).Expand(decode(t, test.src)...)
+		var limit *macro.LimitError
+
+		if !errors.As(err, &limit) || limit.Limit != test.limit || limit.Pos.Line != 2 || limit.Pos.Col != 3 {
+			t.Errorf("%s: got error %v, want %s limit at [2:3]", test.src, err, test.limit)
+		}
+	}
+
+	// The counts start afresh with each call.
+	x := NewExpanderWithOptions(Options{MaxSteps: 3})
+	forms := decode(t, "(define-syntax inc (syntax-rules () ((_ x) (+ x 1)))) (inc (inc 1))")
+
+	for range 3 {
+		if _, err := x.Expand(forms...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
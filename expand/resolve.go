@@ -0,0 +1,394 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package expand
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mowen132/macro"
+)
+
+// scope maps the identifiers bound by a binding form, keyed by name and
+// marks, to the symbols they are renamed to.
+type scope struct {
+	parent *scope
+	names  map[string]macro.Symbol
+	global bool
+}
+
+func (s *scope) child() *scope {
+	return &scope{parent: s, names: map[string]macro.Symbol{}}
+}
+
+func (s *scope) lookup(key string) (macro.Symbol, *scope, bool) {
+	for ; s != nil; s = s.parent {
+		if sym, ok := s.names[key]; ok {
+			return sym, s, true
+		}
+	}
+
+	return "", nil, false
+}
+
+func key(name macro.Symbol, marks []Mark) string {
+	var b strings.Builder
+	b.WriteString(string(name))
+
+	for _, m := range marks {
+		fmt.Fprintf(&b, "\x00%d", m)
+	}
+
+	return b.String()
+}
+
+// resolver renames identifiers in expanded syntax. It runs twice: the first
+// pass records the names of local user bindings that template identifiers
+// would otherwise be captured by, and the second renames.
+type resolver struct {
+	conflicts map[macro.Symbol]bool
+	record    bool
+}
+
+func resolve(forms []Syntax) []macro.Value {
+	r := &resolver{conflicts: map[macro.Symbol]bool{}, record: true}
+	r.body(forms, &scope{names: map[string]macro.Symbol{}, global: true})
+
+	r.record = false
+	return r.body(forms, &scope{names: map[string]macro.Symbol{}, global: true})
+}
+
+// body resolves a sequence of forms in which definitions are visible to each
+// other.
+func (r *resolver) body(forms []Syntax, sc *scope) []macro.Value {
+	for _, form := range forms {
+		r.bindDefinitions(form, sc)
+	}
+
+	vals := make([]macro.Value, len(forms))
+
+	for i, form := range forms {
+		vals[i] = r.resolve(form, sc)
+	}
+
+	return vals
+}
+
+func (r *resolver) bindDefinitions(form Syntax, sc *scope) {
+	list, _ := form.List()
+
+	switch form.head() {
+	case "define":
+		if len(list) < 2 {
+			return
+		}
+
+		target := list[1]
+
+		if sig, ok := target.List(); ok && len(sig) > 0 {
+			target = sig[0]
+		} else if pair, ok := target.Datum.(macro.Pair); ok {
+			target = pair.Car.(Syntax)
+		}
+
+		if _, ok := target.Identifier(); ok {
+			r.bind(target, sc)
+		}
+
+	case "begin":
+		for _, elem := range list[1:] {
+			r.bindDefinitions(elem, sc)
+		}
+	}
+}
+
+func (r *resolver) bind(id Syntax, sc *scope) macro.Symbol {
+	name, _ := id.Identifier()
+	sym := name
+
+	if !r.record && (len(id.Marks) > 0 || (!sc.global && r.conflicts[name])) {
+		sym = macro.Gensym(string(name))
+	}
+
+	sc.names[key(name, id.Marks)] = sym
+	return sym
+}
+
+func (r *resolver) reference(id Syntax, sc *scope) macro.Symbol {
+	name, _ := id.Identifier()
+
+	if sym, _, ok := sc.lookup(key(name, id.Marks)); ok {
+		return sym
+	}
+
+	// A free template identifier refers to the binding of its name where the
+	// macro was defined, so a local user binding must not capture it.
+	if len(id.Marks) > 0 && r.record {
+		if _, s, ok := sc.lookup(key(name, nil)); ok && !s.global {
+			r.conflicts[name] = true
+		}
+	}
+
+	return name
+}
+
+func (r *resolver) resolve(s Syntax, sc *scope) macro.Value {
+	if _, ok := s.Identifier(); ok {
+		return macro.Value{Datum: r.reference(s, sc), Pos: s.Pos, End: s.End}
+	}
+
+	list, ok := s.List()
+
+	if !ok {
+		if pair, ok := s.Datum.(macro.Pair); ok {
+			car := r.resolve(pair.Car.(Syntax), sc)
+			cdr := r.resolve(pair.Cdr.(Syntax), sc)
+			return macro.Value{Datum: macro.Pair{Car: car.Datum, Cdr: cdr.Datum}, Pos: s.Pos, End: s.End}
+		}
+
+		return s.Value()
+	}
+
+	switch s.head() {
+	case "quote":
+		return s.Value()
+
+	case "quasiquote":
+		return r.quasi(s, sc, 0)
+
+	case "lambda":
+		if len(list) >= 2 {
+			inner := sc.child()
+			params := r.params(list[1], inner)
+			return r.form(s, list[0], params, r.body(list[2:], inner))
+		}
+
+	case "let":
+		if len(list) >= 3 {
+			if _, ok := list[1].Identifier(); ok {
+				inner := sc.child()
+				name := macro.Value{Datum: r.bind(list[1], inner), Pos: list[1].Pos, End: list[1].End}
+
+				if bindings, ok := r.parallel(list[2], sc, inner); ok {
+					return r.form(s, list[0], name, bindings, r.body(list[3:], inner))
+				}
+			}
+		}
+
+		if len(list) >= 2 {
+			inner := sc.child()
+
+			if bindings, ok := r.parallel(list[1], sc, inner); ok {
+				return r.form(s, list[0], bindings, r.body(list[2:], inner))
+			}
+		}
+
+	case "let*":
+		if len(list) >= 2 {
+			if bindings, inner, ok := r.sequential(list[1], sc); ok {
+				return r.form(s, list[0], bindings, r.body(list[2:], inner))
+			}
+		}
+
+	case "letrec", "letrec*":
+		if len(list) >= 2 {
+			inner := sc.child()
+
+			if bindings, ok := r.parallel(list[1], inner, inner); ok {
+				return r.form(s, list[0], bindings, r.body(list[2:], inner))
+			}
+		}
+
+	case "define":
+		if len(list) >= 2 {
+			if sig, ok := list[1].List(); ok && len(sig) > 0 {
+				inner := sc.child()
+				name := r.resolve(sig[0], sc)
+				params := r.params(Syntax{Datum: sig[1:], Pos: list[1].Pos, End: list[1].End}, inner)
+				head := macro.ListOf(append([]macro.Value{name}, listItems(params)...)...)
+				head.Pos, head.End = list[1].Pos, list[1].End
+				return r.form(s, list[0], head, r.body(list[2:], inner))
+			}
+
+			if pair, ok := list[1].Datum.(macro.Pair); ok {
+				inner := sc.child()
+				name := r.resolve(pair.Car.(Syntax), sc)
+				rest := r.params(pair.Cdr.(Syntax), inner)
+				head := macro.Value{Datum: macro.Pair{Car: name.Datum, Cdr: rest.Datum}, Pos: list[1].Pos, End: list[1].End}
+				return r.form(s, list[0], head, r.body(list[2:], inner))
+			}
+		}
+	}
+
+	vals := make([]macro.Value, len(list))
+
+	for i, elem := range list {
+		vals[i] = r.resolve(elem, sc)
+	}
+
+	return withSpan(macro.ListOf(vals...), s)
+}
+
+// form builds a list from a head, single values and lists of values.
+func (r *resolver) form(s Syntax, head Syntax, parts ...any) macro.Value {
+	vals := []macro.Value{head.Value()}
+
+	for _, part := range parts {
+		switch p := part.(type) {
+		case macro.Value:
+			vals = append(vals, p)
+
+		case []macro.Value:
+			vals = append(vals, p...)
+		}
+	}
+
+	return withSpan(macro.ListOf(vals...), s)
+}
+
+// params binds the identifiers of a parameter list in sc.
+func (r *resolver) params(p Syntax, sc *scope) macro.Value {
+	if _, ok := p.Identifier(); ok {
+		return macro.Value{Datum: r.bind(p, sc), Pos: p.Pos, End: p.End}
+	}
+
+	if pair, ok := p.Datum.(macro.Pair); ok {
+		car := r.params(pair.Car.(Syntax), sc)
+		cdr := r.params(pair.Cdr.(Syntax), sc)
+		return macro.Value{Datum: macro.Pair{Car: car.Datum, Cdr: cdr.Datum}, Pos: p.Pos, End: p.End}
+	}
+
+	list, ok := p.List()
+
+	if !ok {
+		return p.Value()
+	}
+
+	vals := make([]macro.Value, len(list))
+
+	for i, elem := range list {
+		vals[i] = r.params(elem, sc)
+	}
+
+	return withSpan(macro.ListOf(vals...), p)
+}
+
+// parallel resolves the ((name init) ...) bindings of a let, evaluating the
+// inits in outer and binding the names in inner.
+func (r *resolver) parallel(b Syntax, outer, inner *scope) (macro.Value, bool) {
+	list, ok := b.List()
+
+	if !ok || !areBindings(list) {
+		return macro.Value{}, false
+	}
+
+	for _, binding := range list {
+		pair, _ := binding.List()
+		r.bind(pair[0], inner)
+	}
+
+	vals := make([]macro.Value, len(list))
+
+	for i, binding := range list {
+		pair, _ := binding.List()
+		name := r.reference(pair[0], inner)
+		vals[i] = r.binding(binding, name, pair[1:], outer)
+	}
+
+	return withSpan(macro.ListOf(vals...), b), true
+}
+
+// sequential resolves the bindings of a let*, each in the scope of the
+// previous ones, and returns the scope of the body.
+func (r *resolver) sequential(b Syntax, sc *scope) (macro.Value, *scope, bool) {
+	list, ok := b.List()
+
+	if !ok || !areBindings(list) {
+		return macro.Value{}, nil, false
+	}
+
+	vals := make([]macro.Value, len(list))
+
+	for i, binding := range list {
+		pair, _ := binding.List()
+		inner := sc.child()
+		name := r.bind(pair[0], inner)
+		vals[i] = r.binding(binding, name, pair[1:], sc)
+		sc = inner
+	}
+
+	return withSpan(macro.ListOf(vals...), b), sc, true
+}
+
+func (r *resolver) binding(s Syntax, name macro.Symbol, init []Syntax, sc *scope) macro.Value {
+	list, _ := s.List()
+	vals := []macro.Value{{Datum: name, Pos: list[0].Pos, End: list[0].End}}
+
+	for _, elem := range init {
+		vals = append(vals, r.resolve(elem, sc))
+	}
+
+	return withSpan(macro.ListOf(vals...), s)
+}
+
+func areBindings(list []Syntax) bool {
+	for _, binding := range list {
+		pair, ok := binding.List()
+
+		if !ok || len(pair) < 1 || len(pair) > 2 {
+			return false
+		}
+
+		if _, ok := pair[0].Identifier(); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quasi resolves the unquoted parts of a quasiquoted template.
+func (r *resolver) quasi(s Syntax, sc *scope, depth int) macro.Value {
+	list, ok := s.List()
+
+	if !ok {
+		return s.Value()
+	}
+
+	switch s.head() {
+	case "quasiquote":
+		depth++
+
+	case "unquote":
+		if depth == 1 {
+			vals := []macro.Value{list[0].Value()}
+
+			for _, elem := range list[1:] {
+				vals = append(vals, r.resolve(elem, sc))
+			}
+
+			return withSpan(macro.ListOf(vals...), s)
+		}
+
+		depth--
+	}
+
+	vals := make([]macro.Value, len(list))
+
+	for i, elem := range list {
+		vals[i] = r.quasi(elem, sc, depth)
+	}
+
+	return withSpan(macro.ListOf(vals...), s)
+}
+
+func listItems(v macro.Value) []macro.Value {
+	items, _ := v.List()
+	return items
+}
+
+func withSpan(v macro.Value, s Syntax) macro.Value {
+	v.Pos, v.End = s.Pos, s.End
+	return v
+}
@@ -0,0 +1,436 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package expand
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/mowen132/macro"
+)
+
+const ellipsis = macro.Symbol("...")
+
+// rules is a macro defined by (syntax-rules (literal ...) (pattern template) ...).
+type rules struct {
+	name     macro.Symbol
+	literals map[macro.Symbol]bool
+	clauses  []clause
+}
+
+type clause struct {
+	pattern  Syntax
+	template Syntax
+}
+
+// bindings maps pattern variables to the syntax they matched. A variable
+// followed by n ellipses is bound to n levels of nested []any.
+type bindings map[macro.Symbol]any
+
+func compileRules(name macro.Symbol, spec Syntax) (*rules, error) {
+	list, ok := spec.List()
+
+	if !ok || spec.head() != "syntax-rules" || len(list) < 2 {
+		return nil, fmt.Errorf("%s expected (syntax-rules (literal ...) (pattern template) ...)", spec.Pos)
+	}
+
+	r := &rules{name: name, literals: map[macro.Symbol]bool{}}
+	literals, ok := list[1].List()
+
+	if !ok {
+		return nil, fmt.Errorf("%s expected list of literals", list[1].Pos)
+	}
+
+	for _, lit := range literals {
+		sym, ok := lit.Identifier()
+
+		if !ok {
+			return nil, fmt.Errorf("%s expected literal identifier", lit.Pos)
+		}
+
+		r.literals[sym] = true
+	}
+
+	for _, c := range list[2:] {
+		parts, ok := c.List()
+
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("%s expected (pattern template)", c.Pos)
+		}
+
+		pattern, ok := parts[0].List()
+
+		if !ok || len(pattern) == 0 {
+			return nil, fmt.Errorf("%s expected pattern list", parts[0].Pos)
+		}
+
+		// The head of a pattern stands for the macro keyword and is ignored.
+		args := Syntax{Datum: pattern[1:], Pos: parts[0].Pos, End: parts[0].End}
+
+		if err := r.checkPattern(args, map[macro.Symbol]bool{}); err != nil {
+			return nil, err
+		}
+
+		r.clauses = append(r.clauses, clause{parts[0], parts[1]})
+	}
+
+	return r, nil
+}
+
+func (r *rules) checkPattern(p Syntax, seen map[macro.Symbol]bool) error {
+	switch datum := p.Datum.(type) {
+	case macro.Symbol:
+		if datum == "_" || r.literals[datum] {
+			return nil
+		}
+
+		if datum == ellipsis {
+			return fmt.Errorf("%s misplaced ellipsis in pattern", p.Pos)
+		}
+
+		if seen[datum] {
+			return fmt.Errorf("%s duplicate pattern variable %s", p.Pos, datum)
+		}
+
+		seen[datum] = true
+
+	case []Syntax:
+		found := false
+
+		for i, elem := range datum {
+			if sym, _ := elem.Identifier(); sym == ellipsis {
+				if i == 0 || found {
+					return fmt.Errorf("%s misplaced ellipsis in pattern", elem.Pos)
+				}
+
+				found = true
+				continue
+			}
+
+			if err := r.checkPattern(elem, seen); err != nil {
+				return err
+			}
+		}
+
+	case macro.Pair:
+		if err := r.checkPattern(datum.Car.(Syntax), seen); err != nil {
+			return err
+		}
+
+		return r.checkPattern(datum.Cdr.(Syntax), seen)
+	}
+
+	return nil
+}
+
+// site describes a single expansion: its mark, and the span of the macro use
+// that the syntax the template introduces is attributed to.
+type site struct {
+	mark Mark
+	pos  macro.Position
+	end  macro.Position
+}
+
+// introduce positions template syntax at the use site, so that errors about
+// expanded code point at the macro use rather than the macro definition.
+func (s site) introduce(t Syntax) Syntax {
+	t.Pos, t.End = s.pos, s.end
+	return t
+}
+
+// apply rewrites a use of the macro with the first clause that matches it,
+// marking the identifiers the template introduces with m.
+func (r *rules) apply(use Syntax, m Mark) (Syntax, error) {
+	args, _ := use.List()
+	at := site{m, use.Pos, use.End}
+
+	for _, c := range r.clauses {
+		pattern, _ := c.pattern.List()
+		b := bindings{}
+
+		if r.matchList(pattern[1:], args[1:], b) {
+			return r.expand(c.template, b, at)
+		}
+	}
+
+	return Syntax{}, fmt.Errorf("%s no syntax-rules clause of %s matches", use.Pos, r.name)
+}
+
+func (r *rules) match(p, s Syntax, b bindings) bool {
+	switch datum := p.Datum.(type) {
+	case macro.Symbol:
+		if datum == "_" {
+			return true
+		}
+
+		if r.literals[datum] {
+			sym, ok := s.Identifier()
+			return ok && sym == datum
+		}
+
+		b[datum] = s
+		return true
+
+	case []Syntax:
+		list, ok := s.List()
+		return ok && r.matchList(datum, list, b)
+
+	case macro.Pair:
+		switch target := s.Datum.(type) {
+		case macro.Pair:
+			return r.match(datum.Car.(Syntax), target.Car.(Syntax), b) &&
+				r.match(datum.Cdr.(Syntax), target.Cdr.(Syntax), b)
+
+		case []Syntax:
+			if len(target) == 0 {
+				return false
+			}
+
+			rest := Syntax{Datum: target[1:], Pos: target[0].End, End: s.End, Marks: s.Marks}
+			return r.match(datum.Car.(Syntax), target[0], b) && r.match(datum.Cdr.(Syntax), rest, b)
+		}
+
+		return false
+	}
+
+	return macro.Equal(p.Datum, s.Datum)
+}
+
+func (r *rules) matchList(patterns, list []Syntax, b bindings) bool {
+	at := -1
+
+	for i, p := range patterns {
+		if sym, _ := p.Identifier(); sym == ellipsis {
+			at = i - 1
+		}
+	}
+
+	if at < 0 {
+		if len(patterns) != len(list) {
+			return false
+		}
+
+		for i, p := range patterns {
+			if !r.match(p, list[i], b) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	prefix, repeated, suffix := patterns[:at], patterns[at], patterns[at+2:]
+	n := len(list) - len(prefix) - len(suffix)
+
+	if n < 0 {
+		return false
+	}
+
+	for i, p := range prefix {
+		if !r.match(p, list[i], b) {
+			return false
+		}
+	}
+
+	for i, p := range suffix {
+		if !r.match(p, list[len(prefix)+n+i], b) {
+			return false
+		}
+	}
+
+	seqs := map[macro.Symbol][]any{}
+
+	for _, v := range r.variables(repeated) {
+		seqs[v] = []any{}
+	}
+
+	for _, s := range list[len(prefix) : len(prefix)+n] {
+		each := bindings{}
+
+		if !r.match(repeated, s, each) {
+			return false
+		}
+
+		for v, val := range each {
+			seqs[v] = append(seqs[v], val)
+		}
+	}
+
+	for v, seq := range seqs {
+		b[v] = seq
+	}
+
+	return true
+}
+
+// variables returns the pattern variables of a pattern.
+func (r *rules) variables(p Syntax) []macro.Symbol {
+	switch datum := p.Datum.(type) {
+	case macro.Symbol:
+		if datum != "_" && datum != ellipsis && !r.literals[datum] {
+			return []macro.Symbol{datum}
+		}
+
+	case []Syntax:
+		var vars []macro.Symbol
+
+		for _, elem := range datum {
+			vars = append(vars, r.variables(elem)...)
+		}
+
+		return vars
+
+	case macro.Pair:
+		return append(r.variables(datum.Car.(Syntax)), r.variables(datum.Cdr.(Syntax))...)
+	}
+
+	return nil
+}
+
+func (r *rules) expand(t Syntax, b bindings, at site) (Syntax, error) {
+	switch datum := t.Datum.(type) {
+	case macro.Symbol:
+		val, ok := b[datum]
+
+		if !ok {
+			return at.introduce(t).mark(at.mark), nil
+		}
+
+		s, ok := val.(Syntax)
+
+		if !ok {
+			return Syntax{}, fmt.Errorf("%s pattern variable %s used without ellipsis", t.Pos, datum)
+		}
+
+		return s, nil
+
+	case []Syntax:
+		// (... ...) stands for a literal ellipsis.
+		if len(datum) == 2 && datum[0].Datum == ellipsis {
+			return at.introduce(datum[1]), nil
+		}
+
+		var list []Syntax
+
+		for i := 0; i < len(datum); i++ {
+			if i+1 < len(datum) && datum[i+1].Datum == ellipsis {
+				elems, err := r.expandRepeated(datum[i], b, at)
+
+				if err != nil {
+					return Syntax{}, err
+				}
+
+				list = append(list, elems...)
+				i++
+				continue
+			}
+
+			elem, err := r.expand(datum[i], b, at)
+
+			if err != nil {
+				return Syntax{}, err
+			}
+
+			list = append(list, elem)
+		}
+
+		t.Datum = list
+		return at.introduce(t), nil
+
+	case macro.Pair:
+		car, err := r.expand(datum.Car.(Syntax), b, at)
+
+		if err != nil {
+			return Syntax{}, err
+		}
+
+		cdr, err := r.expand(datum.Cdr.(Syntax), b, at)
+
+		if err != nil {
+			return Syntax{}, err
+		}
+
+		// A template such as (a . rest) with rest bound to a list builds a list.
+		if list, ok := cdr.List(); ok {
+			t.Datum = append([]Syntax{car}, list...)
+		} else {
+			t.Datum = macro.Pair{Car: car, Cdr: cdr}
+		}
+
+		return at.introduce(t), nil
+	}
+
+	return at.introduce(t), nil
+}
+
+// expandRepeated expands a template followed by an ellipsis once for each
+// element of the sequences bound to its pattern variables.
+func (r *rules) expandRepeated(t Syntax, b bindings, at site) ([]Syntax, error) {
+	n := -1
+	vars := r.templateVariables(t, b)
+
+	for _, v := range vars {
+		seq, ok := b[v].([]any)
+
+		if !ok {
+			continue
+		}
+
+		if n >= 0 && len(seq) != n {
+			return nil, fmt.Errorf("%s pattern variables under ellipsis matched different numbers of elements", t.Pos)
+		}
+
+		n = len(seq)
+	}
+
+	if n < 0 {
+		return nil, fmt.Errorf("%s no pattern variable under ellipsis", t.Pos)
+	}
+
+	list := make([]Syntax, 0, n)
+
+	for i := range n {
+		each := maps.Clone(b)
+
+		for _, v := range vars {
+			if seq, ok := b[v].([]any); ok {
+				each[v] = seq[i]
+			}
+		}
+
+		elem, err := r.expand(t, each, at)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, elem)
+	}
+
+	return list, nil
+}
+
+// templateVariables returns the pattern variables used in a template.
+func (r *rules) templateVariables(t Syntax, b bindings) []macro.Symbol {
+	switch datum := t.Datum.(type) {
+	case macro.Symbol:
+		if _, ok := b[datum]; ok {
+			return []macro.Symbol{datum}
+		}
+
+	case []Syntax:
+		var vars []macro.Symbol
+
+		for _, elem := range datum {
+			vars = append(vars, r.templateVariables(elem, b)...)
+		}
+
+		return vars
+
+	case macro.Pair:
+		return append(r.templateVariables(datum.Car.(Syntax), b), r.templateVariables(datum.Cdr.(Syntax), b)...)
+	}
+
+	return nil
+}
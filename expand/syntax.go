@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package expand
+
+import (
+	"slices"
+
+	"github.com/mowen132/macro"
+)
+
+// Mark identifies a single macro expansion step. Identifiers a macro
+// template introduces carry the mark of the step that introduced them.
+type Mark int
+
+// Syntax is a datum together with its source span and the marks of the
+// expansion steps that introduced it. The Datum of a list is a []Syntax and
+// that of a dotted pair a macro.Pair of Syntax; other data are atoms.
+type Syntax struct {
+	Datum any
+	Pos   macro.Position
+	End   macro.Position
+	Marks []Mark
+}
+
+// FromValue converts a decoded value to unmarked syntax.
+func FromValue(v macro.Value) Syntax {
+	s := Syntax{Datum: v.Datum, Pos: v.Pos, End: v.End}
+
+	switch datum := v.Datum.(type) {
+	case []any:
+		items, _ := v.List()
+		list := make([]Syntax, len(items))
+
+		for i, item := range items {
+			list[i] = FromValue(item)
+		}
+
+		s.Datum = list
+
+	case macro.Pair:
+		s.Datum = macro.Pair{
+			Car: FromValue(macro.Value{Datum: datum.Car, Pos: v.Pos, End: v.End}),
+			Cdr: FromValue(macro.Value{Datum: datum.Cdr, Pos: v.Pos, End: v.End}),
+		}
+	}
+
+	return s
+}
+
+// Value converts syntax back to a value, discarding marks.
+func (s Syntax) Value() macro.Value {
+	switch datum := s.Datum.(type) {
+	case []Syntax:
+		items := make([]macro.Value, len(datum))
+
+		for i, item := range datum {
+			items[i] = item.Value()
+		}
+
+		v := macro.ListOf(items...)
+		v.Pos, v.End = s.Pos, s.End
+		return v
+
+	case macro.Pair:
+		car := datum.Car.(Syntax).Value()
+		cdr := datum.Cdr.(Syntax).Value()
+		return macro.Value{Datum: macro.Pair{Car: car.Datum, Cdr: cdr.Datum}, Pos: s.Pos, End: s.End}
+	}
+
+	return macro.Value{Datum: s.Datum, Pos: s.Pos, End: s.End}
+}
+
+// Identifier returns the symbol of an identifier.
+func (s Syntax) Identifier() (macro.Symbol, bool) {
+	sym, ok := s.Datum.(macro.Symbol)
+	return sym, ok
+}
+
+// List returns the elements of a list.
+func (s Syntax) List() ([]Syntax, bool) {
+	list, ok := s.Datum.([]Syntax)
+	return list, ok
+}
+
+// head returns the head symbol of a form.
+func (s Syntax) head() macro.Symbol {
+	if list, ok := s.List(); ok && len(list) > 0 {
+		if sym, ok := list[0].Identifier(); ok {
+			return sym
+		}
+	}
+
+	return ""
+}
+
+func (s Syntax) mark(m Mark) Syntax {
+	s.Marks = append(slices.Clip(s.Marks), m)
+	return s
+}
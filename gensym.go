@@ -0,0 +1,24 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var gensyms atomic.Uint64
+
+// Gensym returns a new symbol named prefix%N, where N differs on every call,
+// for use as an identifier that cannot clash with other identifiers a program
+// generates. Input that itself contains symbols of this form may still clash
+// with it. The symbol is printed like any other, so expanded code can be
+// encoded and read back.
+func Gensym(prefix string) Symbol {
+	if prefix == "" {
+		prefix = "g"
+	}
+
+	return Symbol(fmt.Sprintf("%s%%%d", prefix, gensyms.Add(1)))
+}
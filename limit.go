@@ -0,0 +1,21 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"fmt"
+)
+
+// LimitError reports input that exceeds one of the limits set in
+// DecoderOptions or ScannerOptions, or in the options of the eval and expand
+// packages.
+type LimitError struct {
+	Limit string
+	Max   int
+	Pos   Position
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %s exceeds limit of %d", e.Pos, e.Limit, e.Max)
+}
@@ -5,11 +5,22 @@ package macro
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"reflect"
 )
 
+// Marshal encodes val, quoting symbols as |...| where needed. It rejects
+// data that Unmarshal would read back as something else: Tagged values, whose
+// tags Unmarshal does not know, and maps and Dicts, which Unmarshal reads as
+// (dict ...) lists.
 func Marshal(val any) ([]byte, error) {
+	if err := checkMarshal(val); err != nil {
+		return nil, err
+	}
+
 	var b bytes.Buffer
-	e := NewEncoder(&b)
+	e := NewEncoderWithOptions(&b, EncoderOptions{Printer: PrinterOptions{QuotedSymbols: true}})
 
 	if err := e.Encode(val); err != nil {
 		return nil, err
@@ -22,7 +33,51 @@ func Marshal(val any) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// Unmarshal decodes the first value in b, reading |...| as quoted symbols.
 func Unmarshal(b []byte) (any, error) {
-	d := NewDecoder(bytes.NewReader(b))
-	return d.Decode()
+	d := NewDecoderWithOptions(bytes.NewReader(b), DecoderOptions{Scanner: ScannerOptions{QuotedSymbols: true}})
+	val, err := d.Decode()
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return val, err
+}
+
+func checkMarshal(val any) error {
+	switch v := val.(type) {
+	case Value:
+		return checkMarshal(v.Datum)
+
+	case []any:
+		for _, elem := range v {
+			if err := checkMarshal(elem); err != nil {
+				return err
+			}
+		}
+
+	case Verbatim:
+		return checkMarshal([]any(v))
+
+	case Pair:
+		if err := checkMarshal(v.Car); err != nil {
+			return err
+		}
+
+		return checkMarshal(v.Cdr)
+
+	case Tagged:
+		return fmt.Errorf("cannot marshal #%s literal: Unmarshal does not know the tag", v.Tag)
+
+	case *Dict[any]:
+		return fmt.Errorf("cannot marshal %T: Unmarshal reads dicts as (dict ...) lists", val)
+
+	default:
+		if val != nil && reflect.TypeOf(val).Kind() == reflect.Map {
+			return fmt.Errorf("cannot marshal %T: Unmarshal reads dicts as (dict ...) lists", val)
+		}
+	}
+
+	return nil
 }
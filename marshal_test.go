@@ -0,0 +1,284 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// datum is a random value. Those containing Tagged values, maps or Dicts,
+// which Unmarshal cannot read back, are marked rejected.
+type datum struct {
+	val      any
+	rejected bool
+}
+
+func (datum) Generate(r *rand.Rand, size int) reflect.Value {
+	var d datum
+
+	// Most values are ones Marshal accepts.
+	if r.Intn(4) == 0 {
+		d.val = randomDatum(r, 4, &d.rejected)
+	} else {
+		d.val = randomDatum(r, 4, nil)
+	}
+
+	return reflect.ValueOf(d)
+}
+
+// randomDatum returns a random datum. With rejected nil it only returns data
+// that Marshal accepts, and otherwise sets *rejected if it returns one that
+// Marshal rejects.
+func randomDatum(r *rand.Rand, depth int, rejected *bool) any {
+	n := 7
+
+	if depth > 0 {
+		n = 11
+	}
+
+	switch r.Intn(n) {
+	case 0:
+		return randomInt(r)
+
+	case 1:
+		return randomFloat(r)
+
+	case 2:
+		return randomString(r, "ab \"\\\n\t\r\x00\x1f\x7fé😀|")
+
+	case 3, 4:
+		return randomSymbol(r)
+
+	case 5:
+		return time.Date(2000+r.Intn(100), time.Month(1+r.Intn(12)), 1+r.Intn(28),
+			r.Intn(24), r.Intn(60), r.Intn(60), r.Intn(2)*r.Intn(1e9), time.UTC)
+
+	case 6:
+		if rejected == nil {
+			return randomInt(r)
+		}
+
+		*rejected = true
+		return Tagged{"uuid", randomString(r, "0af-")}
+
+	case 7:
+		return randomList(r, depth-1, rejected)
+
+	case 8:
+		return Verbatim(randomList(r, depth-1, rejected))
+
+	case 9:
+		return randomPair(r, depth-1, rejected)
+	}
+
+	return randomDict(r, depth-1, rejected)
+}
+
+func randomInt(r *rand.Rand) int {
+	switch r.Intn(4) {
+	case 0:
+		return math.MaxInt64
+
+	case 1:
+		return math.MinInt64
+	}
+
+	return r.Intn(2000) - 1000
+}
+
+func randomFloat(r *rand.Rand) float64 {
+	switch r.Intn(5) {
+	case 0:
+		return float64(r.Intn(2000) - 1000)
+
+	case 1:
+		return 1e21
+
+	case 2:
+		return 5e-324
+	}
+
+	return r.NormFloat64() * math.Pow(10, float64(r.Intn(40)-20))
+}
+
+func randomString(r *rand.Rand, chars string) string {
+	runes := []rune(chars)
+	var b strings.Builder
+
+	for range r.Intn(6) {
+		b.WriteRune(runes[r.Intn(len(runes))])
+	}
+
+	return b.String()
+}
+
+// randomSymbol returns plain symbols as well as ones that only read back
+// when quoted with |...|, such as those that look like numbers or contain
+// delimiters.
+func randomSymbol(r *rand.Rand) Symbol {
+	special := []Symbol{"", ".", "...", "+", "-", "1", "+1", "-.5", "1e3", "#t", "#inst", "|a", "a|b", "Abc", "quote", "dict"}
+
+	if r.Intn(3) == 0 {
+		return special[r.Intn(len(special))]
+	}
+
+	return Symbol(randomString(r, "abz-+.#|()[]{}\"';\\ \né1"))
+}
+
+func randomList(r *rand.Rand, depth int, rejected *bool) []any {
+	list := make([]any, r.Intn(4))
+
+	for i := range list {
+		list[i] = randomDatum(r, depth, rejected)
+	}
+
+	return list
+}
+
+// randomDict returns a (dict ...) list, or a map or Dict when rejected is
+// not nil.
+func randomDict(r *rand.Rand, depth int, rejected *bool) any {
+	dict := NewDict[any]()
+
+	for range r.Intn(4) {
+		if key := randomKey(r); !dictHas(dict, key) {
+			dict.Set(key, randomDatum(r, depth, rejected))
+		}
+	}
+
+	if rejected != nil && r.Intn(2) == 0 {
+		*rejected = true
+
+		if r.Intn(2) == 0 {
+			return dict
+		}
+
+		m := map[any]any{}
+
+		for k, v := range dict.All() {
+			m[k] = v
+		}
+
+		return m
+	}
+
+	list := []any{Symbol("dict")}
+
+	for k, v := range dict.All() {
+		list = append(list, k, v)
+	}
+
+	return list
+}
+
+func dictHas(dict *Dict[any], key any) bool {
+	_, ok := dict.Get(key)
+	return ok
+}
+
+// randomPair returns a dotted pair or improper list, or occasionally a pair
+// whose tail is a list, which reads back as a proper list.
+func randomPair(r *rand.Rand, depth int, rejected *bool) Pair {
+	var tail any
+
+	switch r.Intn(4) {
+	case 0:
+		tail = randomPair(r, depth, rejected)
+
+	case 1:
+		tail = randomList(r, depth, rejected)
+
+	default:
+		tail = randomKey(r)
+	}
+
+	return Pair{Car: randomDatum(r, depth, rejected), Cdr: tail}
+}
+
+func randomKey(r *rand.Rand) any {
+	switch r.Intn(4) {
+	case 0:
+		return randomInt(r)
+
+	case 1:
+		return randomFloat(r)
+
+	case 2:
+		return randomString(r, "ab\"\\\n")
+	}
+
+	return randomSymbol(r)
+}
+
+// decoded returns val as Unmarshal reads it back: Verbatim lists are plain
+// lists, and pairs whose tail is a list are spliced into it.
+func decoded(val any) any {
+	switch v := val.(type) {
+	case Verbatim:
+		return decoded([]any(v))
+
+	case []any:
+		list := make([]any, len(v))
+
+		for i, elem := range v {
+			list[i] = decoded(elem)
+		}
+
+		return list
+
+	case Pair:
+		car, cdr := decoded(v.Car), decoded(v.Cdr)
+
+		if list, ok := cdr.([]any); ok {
+			return append([]any{car}, list...)
+		}
+
+		return Pair{Car: car, Cdr: cdr}
+	}
+
+	return val
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	roundTrip := func(d datum) bool {
+		b, err := Marshal(d.val)
+
+		if d.rejected {
+			if err == nil {
+				t.Logf("Marshal(%#v) = %s, want error", d.val, b)
+			}
+
+			return err != nil
+		}
+
+		if err != nil {
+			t.Logf("Marshal(%#v): %v", d.val, err)
+			return false
+		}
+
+		got, err := Unmarshal(b)
+
+		if err != nil {
+			t.Logf("Unmarshal(%s): %v", b, err)
+			return false
+		}
+
+		if want := decoded(d.val); !Equal(got, want) {
+			t.Logf("Unmarshal(%s) = %#v, want %#v", b, got, want)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package match implements structural pattern matching over decoded
+// S-expressions. Patterns are themselves S-expressions:
+//
+//	(define ?name (lambda ?args ?@body))
+//
+// A symbol ?name matches any datum and binds it to name; if the name appears
+// more than once, every occurrence must match an equal datum. A symbol ?@name
+// inside a list matches zero or more elements and binds them as a list; each
+// list may contain at most one. The symbols ? and _ match anything without
+// binding, and ?@ matches any run of elements. Every other datum matches an
+// equal datum.
+package match
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mowen132/macro"
+)
+
+// Bindings maps variable names to the values they matched. A splice variable
+// is bound to a list of the elements it matched.
+type Bindings map[string]macro.Value
+
+type Pattern struct {
+	root node
+}
+
+// Compile compiles a pattern datum, such as one returned by Decoder.Decode.
+func Compile(pattern any) (*Pattern, error) {
+	root, err := compile(pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pattern{root}, nil
+}
+
+// Parse decodes a single pattern from src and compiles it.
+func Parse(src string) (*Pattern, error) {
+	d := macro.NewDecoder(bytes.NewReader([]byte(src)))
+	pattern, err := d.Decode()
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if extra, err := d.DecodeValue(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%s unexpected datum after pattern", extra.Pos)
+	}
+
+	return Compile(pattern)
+}
+
+// MustParse is like Parse but panics if the pattern is invalid.
+func MustParse(src string) *Pattern {
+	p, err := Parse(src)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// Match matches a datum against the pattern.
+func (p *Pattern) Match(datum any) (Bindings, bool) {
+	return p.MatchValue(macro.ValueOf(datum))
+}
+
+// MatchValue matches a value against the pattern. Bound values keep the
+// positions recorded in v.
+func (p *Pattern) MatchValue(v macro.Value) (Bindings, bool) {
+	b := Bindings{}
+
+	if !p.root.match(b, v) {
+		return nil, false
+	}
+
+	return b, true
+}
+
+type node interface {
+	match(b Bindings, v macro.Value) bool
+}
+
+type literal struct {
+	datum any
+}
+
+type variable struct {
+	name string
+}
+
+type list struct {
+	prefix []node
+	splice *variable
+	suffix []node
+}
+
+type pair struct {
+	car node
+	cdr node
+}
+
+type tagged struct {
+	tag macro.Symbol
+	val node
+}
+
+func compile(pattern any) (node, error) {
+	switch v := pattern.(type) {
+	case macro.Symbol:
+		if name, ok := spliceName(v); ok {
+			return nil, fmt.Errorf("splice ?@%s outside list", name)
+		}
+
+		if v == "?" || v == "_" {
+			return &variable{}, nil
+		}
+
+		if name, ok := strings.CutPrefix(string(v), "?"); ok {
+			return &variable{name}, nil
+		}
+
+	case []any:
+		return compileList(v)
+
+	case macro.Pair:
+		car, err := compile(v.Car)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cdr, err := compile(v.Cdr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &pair{car, cdr}, nil
+
+	case macro.Tagged:
+		val, err := compile(v.Val)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &tagged{v.Tag, val}, nil
+	}
+
+	return &literal{pattern}, nil
+}
+
+func compileList(elems []any) (node, error) {
+	l := &list{}
+
+	for _, elem := range elems {
+		if sym, ok := elem.(macro.Symbol); ok {
+			if name, ok := spliceName(sym); ok {
+				if l.splice != nil {
+					return nil, fmt.Errorf("more than one splice in list: ?@%s and ?@%s", l.splice.name, name)
+				}
+
+				l.splice = &variable{name}
+				continue
+			}
+		}
+
+		n, err := compile(elem)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if l.splice == nil {
+			l.prefix = append(l.prefix, n)
+		} else {
+			l.suffix = append(l.suffix, n)
+		}
+	}
+
+	return l, nil
+}
+
+func spliceName(sym macro.Symbol) (string, bool) {
+	return strings.CutPrefix(string(sym), "?@")
+}
+
+func (n *literal) match(b Bindings, v macro.Value) bool {
+	return macro.Equal(n.datum, v.Datum)
+}
+
+func (n *variable) match(b Bindings, v macro.Value) bool {
+	if n.name == "" {
+		return true
+	}
+
+	if prev, ok := b[n.name]; ok {
+		return macro.Equal(prev.Datum, v.Datum)
+	}
+
+	b[n.name] = v
+	return true
+}
+
+func (n *list) match(b Bindings, v macro.Value) bool {
+	items, err := v.List()
+
+	if err != nil {
+		return false
+	}
+
+	fixed := len(n.prefix) + len(n.suffix)
+
+	if len(items) < fixed || (n.splice == nil && len(items) != fixed) {
+		return false
+	}
+
+	for i, elem := range n.prefix {
+		if !elem.match(b, items[i]) {
+			return false
+		}
+	}
+
+	rest := items[len(n.prefix) : len(items)-len(n.suffix)]
+
+	if n.splice != nil && !n.splice.match(b, spliced(v, rest)) {
+		return false
+	}
+
+	for i, elem := range n.suffix {
+		if !elem.match(b, items[len(items)-len(n.suffix)+i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// spliced returns the run of items matched by a splice. An empty run is
+// positioned at the end of the enclosing list.
+func spliced(parent macro.Value, items []macro.Value) macro.Value {
+	if len(items) == 0 {
+		return macro.Value{Datum: []any{}, Pos: parent.End, End: parent.End}
+	}
+
+	return macro.ListOf(items...)
+}
+
+// match matches a pair against a Pair, or against a non-empty list whose
+// first element matches the car and whose remaining elements match the cdr.
+func (n *pair) match(b Bindings, v macro.Value) bool {
+	switch datum := v.Datum.(type) {
+	case macro.Pair:
+		car := macro.Value{Datum: datum.Car, Pos: v.Pos, End: v.End}
+		cdr := macro.Value{Datum: datum.Cdr, Pos: v.Pos, End: v.End}
+		return n.car.match(b, car) && n.cdr.match(b, cdr)
+
+	case []any:
+		items, _ := v.List()
+
+		if len(items) == 0 {
+			return false
+		}
+
+		return n.car.match(b, items[0]) && n.cdr.match(b, spliced(v, items[1:]))
+	}
+
+	return false
+}
+
+func (n *tagged) match(b Bindings, v macro.Value) bool {
+	datum, ok := v.Datum.(macro.Tagged)
+
+	if !ok || datum.Tag != n.tag {
+		return false
+	}
+
+	return n.val.match(b, macro.Value{Datum: datum.Val, Pos: v.Pos, End: v.End})
+}
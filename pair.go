@@ -0,0 +1,12 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+// Pair is a cons cell whose Cdr is not a proper list. An improper list such as
+// (a b . c) is represented as Pair{a, Pair{b, c}}; dotted forms whose tail is a
+// proper list, such as (a . (b c)), decode to the equivalent []any.
+type Pair struct {
+	Car any
+	Cdr any
+}
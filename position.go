@@ -5,13 +5,75 @@ package macro
 
 import (
 	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
+// Position is a location in source text. Line and Col start at 1, with Col
+// counted in the ColumnUnit chosen for the Scanner or Printer. Offset is the
+// number of bytes preceding the location. File optionally names the source.
 type Position struct {
-	Line int
-	Col  int
+	File   string
+	Line   int
+	Col    int
+	Offset int
 }
 
+type ColumnUnit int
+
+const (
+	// ColumnRunes counts columns in Unicode code points.
+	ColumnRunes ColumnUnit = iota
+
+	// ColumnBytes counts columns in UTF-8 bytes.
+	ColumnBytes
+
+	// ColumnUTF16 counts columns in UTF-16 code units, as used by LSP.
+	ColumnUTF16
+)
+
+// String formats p as a prefix for messages: file:line:col: when the file is
+// known and [line:col] otherwise.
 func (p Position) String() string {
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d:%d:", p.File, p.Line, p.Col)
+	}
+
 	return fmt.Sprintf("[%d:%d]", p.Line, p.Col)
 }
+
+func (u ColumnUnit) width(c rune, size int) int {
+	if c < 0 {
+		return 0
+	}
+
+	switch u {
+	case ColumnBytes:
+		return size
+
+	case ColumnUTF16:
+		return utf16.RuneLen(c)
+
+	default:
+		return 1
+	}
+}
+
+func (u ColumnUnit) widthString(s string) int {
+	switch u {
+	case ColumnBytes:
+		return len(s)
+
+	case ColumnUTF16:
+		n := 0
+
+		for _, c := range s {
+			n += utf16.RuneLen(c)
+		}
+
+		return n
+
+	default:
+		return utf8.RuneCountInString(s)
+	}
+}
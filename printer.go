@@ -8,17 +8,44 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+type PrinterOptions struct {
+	// Columns selects the unit counted by Position.Col.
+	Columns ColumnUnit
+
+	// SymbolStart, SymbolChar, FoldCase and QuotedSymbols describe the
+	// symbol syntax of the Scanner that will read the output, as in
+	// ScannerOptions. Symbols that would not scan back unchanged are printed
+	// as |quoted| symbols when QuotedSymbols is set, and rejected otherwise.
+	SymbolStart   func(c rune) bool
+	SymbolChar    func(c rune) bool
+	FoldCase      bool
+	QuotedSymbols bool
+
+	// Tags lists the tags registered with the Scanner that will read the
+	// output. A symbol such as #inst naming one of them is not plain, since
+	// it may read back as a tag.
+	Tags []string
+}
+
 type Printer struct {
+	opts   PrinterOptions
 	writer *bufio.Writer
 	pos    Position
 }
 
 func NewPrinter(w io.Writer) *Printer {
+	return NewPrinterWithOptions(w, PrinterOptions{})
+}
+
+func NewPrinterWithOptions(w io.Writer, opts PrinterOptions) *Printer {
 	return &Printer{
+		opts:   opts,
 		writer: bufio.NewWriter(w),
-		pos:    Position{1, 1},
+		pos:    Position{"", 1, 1, 0},
 	}
 }
 
@@ -54,6 +81,9 @@ func (p *Printer) PrintToken(tok *Token) error {
 	case TokenRightCurly:
 		return p.PrintRightCurly()
 
+	case TokenLeftSet:
+		return p.PrintLeftSet()
+
 	case TokenQuote:
 		return p.PrintQuote()
 
@@ -63,6 +93,15 @@ func (p *Printer) PrintToken(tok *Token) error {
 	case TokenUnquote:
 		return p.PrintUnquote()
 
+	case TokenDot:
+		return p.PrintDot()
+
+	case TokenTag:
+		return p.PrintTag(tok.Val)
+
+	case TokenMacro:
+		return p.PrintMacro(tok.Val)
+
 	case TokenWhitespace:
 		return p.PrintWhitespace(tok.Val)
 
@@ -85,44 +124,22 @@ func (p *Printer) PrintFloat(val string) error {
 }
 
 func (p *Printer) PrintString(val string) error {
-	var s strings.Builder
-	s.Grow(len(val) + 2)
-	s.WriteByte('"')
-
-	for _, c := range val {
-		switch c {
-		case '"':
-			s.WriteString("\\\"")
-
-		case '\\':
-			s.WriteString("\\\\")
-
-		case '\b':
-			s.WriteString("\\b")
-
-		case '\f':
-			s.WriteString("\\f")
-
-		case '\n':
-			s.WriteString("\\n")
-
-		case '\r':
-			s.WriteString("\\r")
-
-		case '\t':
-			s.WriteString("\\t")
+	return p.writeString(quote(val, '"'))
+}
 
-		default:
-			s.WriteRune(c)
-		}
+// PrintSymbol prints val, enclosing it in |...| when it would not otherwise
+// scan back as the same symbol. Without QuotedSymbols such a symbol is an
+// error.
+func (p *Printer) PrintSymbol(val string) error {
+	if p.isPlainSymbol(val) {
+		return p.writeString(val)
 	}
 
-	s.WriteByte('"')
-	return p.writeString(s.String())
-}
+	if !p.opts.QuotedSymbols {
+		return fmt.Errorf("symbol %q would not read back without quoting", val)
+	}
 
-func (p *Printer) PrintSymbol(val string) error {
-	return p.writeString(val)
+	return p.writeString(quote(val, '|'))
 }
 
 func (p *Printer) PrintLeftParenthesis() error {
@@ -149,6 +166,10 @@ func (p *Printer) PrintRightCurly() error {
 	return p.writeByte('}')
 }
 
+func (p *Printer) PrintLeftSet() error {
+	return p.writeString("#{")
+}
+
 func (p *Printer) PrintQuote() error {
 	return p.writeByte('\'')
 }
@@ -161,6 +182,22 @@ func (p *Printer) PrintUnquote() error {
 	return p.writeByte(',')
 }
 
+func (p *Printer) PrintDot() error {
+	return p.writeByte('.')
+}
+
+func (p *Printer) PrintTag(val string) error {
+	if err := p.writeByte('#'); err != nil {
+		return err
+	}
+
+	return p.writeString(val)
+}
+
+func (p *Printer) PrintMacro(val string) error {
+	return p.writeString(val)
+}
+
 func (p *Printer) PrintWhitespace(val string) error {
 	return p.writeString(val)
 }
@@ -176,6 +213,7 @@ func (p *Printer) PrintComment(val string) error {
 func (p *Printer) PrintNewline() error {
 	p.pos.Line++
 	p.pos.Col = 1
+	p.pos.Offset++
 	return p.writer.WriteByte('\n')
 }
 
@@ -188,12 +226,145 @@ func (p *Printer) Flush() error {
 }
 
 func (p *Printer) writeString(s string) error {
-	p.pos.Col += len(s)
+	p.pos.Col += p.opts.Columns.widthString(s)
+	p.pos.Offset += len(s)
 	_, err := p.writer.WriteString(s)
 	return err
 }
 
 func (p *Printer) writeByte(c byte) error {
 	p.pos.Col++
+	p.pos.Offset++
 	return p.writer.WriteByte(c)
 }
+
+func (p *Printer) isPlainSymbol(val string) bool {
+	if val == "" || val == "." || p.opts.QuotedSymbols && val[0] == '|' ||
+		p.opts.FoldCase && strings.ToLower(val) != val {
+		return false
+	}
+
+	c, n := utf8.DecodeRuneInString(val)
+	rest := val[n:]
+
+	switch c {
+	case '+', '-':
+		if rest == "" {
+			return true
+		}
+
+		c, n = utf8.DecodeRuneInString(rest)
+
+		switch {
+		case c == '.':
+			return p.isPlainDotted(rest)
+
+		case c >= '0' && c <= '9' || !p.isSymbolChar(c):
+			return false
+		}
+
+		return p.areSymbolChars(rest[n:])
+
+	case '.':
+		return p.isPlainDotted(val)
+
+	case '#':
+		c, _ = utf8.DecodeRuneInString(rest)
+
+		if unicode.IsLetter(c) {
+			return !p.isTag(rest) && p.areSymbolChars(rest)
+		}
+
+		return c != '{' && p.areSymbolChars(rest)
+
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return false
+	}
+
+	if p.opts.SymbolStart != nil {
+		if !p.opts.SymbolStart(c) {
+			return false
+		}
+	} else if !DefaultSymbolStart(c) {
+		return false
+	}
+
+	return p.areSymbolChars(rest)
+}
+
+func (p *Printer) isTag(name string) bool {
+	for _, tag := range p.opts.Tags {
+		if tag == name || p.opts.FoldCase && strings.ToLower(tag) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Printer) isPlainDotted(val string) bool {
+	rest := val[1:]
+
+	if c, _ := utf8.DecodeRuneInString(rest); c >= '0' && c <= '9' {
+		return false
+	}
+
+	return p.areSymbolChars(rest)
+}
+
+func (p *Printer) areSymbolChars(val string) bool {
+	for _, c := range val {
+		if !p.isSymbolChar(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Printer) isSymbolChar(c rune) bool {
+	if p.opts.SymbolChar != nil {
+		return p.opts.SymbolChar(c)
+	}
+
+	return DefaultSymbolChar(c)
+}
+
+func quote(val string, q rune) string {
+	var s strings.Builder
+	s.Grow(len(val) + 2)
+	s.WriteRune(q)
+
+	for _, c := range val {
+		switch c {
+		case q, '\\':
+			s.WriteByte('\\')
+			s.WriteRune(c)
+
+		case '\b':
+			s.WriteString("\\b")
+
+		case '\f':
+			s.WriteString("\\f")
+
+		case '\n':
+			s.WriteString("\\n")
+
+		case '\r':
+			s.WriteString("\\r")
+
+		case '\t':
+			s.WriteString("\\t")
+
+		default:
+			if c < ' ' || c == '\x7f' {
+				fmt.Fprintf(&s, "\\u%04x", c)
+			} else {
+				s.WriteRune(c)
+			}
+		}
+	}
+
+	s.WriteRune(q)
+	return s.String()
+}
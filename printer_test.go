@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintHashSymbol(t *testing.T) {
+	var b bytes.Buffer
+	p := NewPrinter(&b)
+
+	for _, val := range []string{"#t", "#f", "#foo-bar", "#!x"} {
+		b.Reset()
+
+		if err := p.PrintToken(&Token{Kind: TokenSymbol, Val: val}); err != nil {
+			t.Errorf("PrintToken(%s): %v", val, err)
+			continue
+		}
+
+		if err := p.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != val {
+			t.Errorf("PrintToken(%s) printed %s", val, b.String())
+		}
+	}
+
+	for _, val := range []string{"#{", "#inst"} {
+		err := NewPrinterWithOptions(&b, PrinterOptions{Tags: []string{"inst"}}).PrintSymbol(val)
+
+		if err == nil {
+			t.Errorf("PrintSymbol(%s) succeeded, want error", val)
+		}
+	}
+}
+
+func TestMarshalHashSymbol(t *testing.T) {
+	tests := []struct {
+		val  Symbol
+		want string
+	}{
+		{"#t", "#t"},
+		{"#inst", `|#inst|`},
+	}
+
+	for _, test := range tests {
+		b, err := Marshal(test.val)
+
+		if err != nil || string(b) != test.want {
+			t.Errorf("Marshal(%s) = %s, %v, want %s", test.val, b, err, test.want)
+			continue
+		}
+
+		if val, err := Unmarshal(b); err != nil || val != test.val {
+			t.Errorf("Unmarshal(%s) = %#v, %v, want %#v", b, val, err, test.val)
+		}
+	}
+
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+
+	if err := e.Encode([]any{Symbol("if"), Symbol("#t"), 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Flush(); err != nil || b.String() != "(if #t 1 2)" {
+		t.Errorf("Encode wrote %s, %v, want (if #t 1 2)", b.String(), err)
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package query selects values from decoded S-expression documents. A query
+// is a list of steps, each applied to every value selected by the previous
+// step:
+//
+//	(server * (port ?))
+//
+// The steps are:
+//
+//	name       forms headed by the symbol name
+//	*          every child
+//	**         the value itself and all of its descendants
+//	n          the element at index n of a list, counting from the end if negative
+//	"key" :key the value stored under key in a dict
+//	(pattern)  children matching a match pattern; if the pattern contains the
+//	           symbol ?, the datum matched there is selected instead
+//	(? q ...)  keeps the values for which the query (q ...) selects anything
+//
+// The children of a dict are its values, and the children of a form headed
+// by a symbol are its arguments. The document a query is applied to is a
+// list of top-level forms, all of which are its children, even when the
+// first is a symbol.
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mowen132/macro"
+	"github.com/mowen132/macro/match"
+)
+
+// selection is the variable name the selection marker ? is rewritten to.
+const selection = "?."
+
+type Query struct {
+	steps []step
+}
+
+// Compile compiles a query datum, such as one returned by Decoder.Decode. A
+// datum that is not a list is a query of a single step.
+func Compile(query any) (*Query, error) {
+	steps, ok := query.([]any)
+
+	if !ok {
+		steps = []any{query}
+	}
+
+	q := &Query{}
+
+	for _, s := range steps {
+		compiled, err := compile(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		q.steps = append(q.steps, compiled)
+	}
+
+	return q, nil
+}
+
+// Parse decodes a single query from src and compiles it.
+func Parse(src string) (*Query, error) {
+	d := macro.NewDecoder(bytes.NewReader([]byte(src)))
+	query, err := d.Decode()
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if extra, err := d.DecodeValue(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%s unexpected datum after query", extra.Pos)
+	}
+
+	return Compile(query)
+}
+
+// MustParse is like Parse but panics if the query is invalid.
+func MustParse(src string) *Query {
+	q, err := Parse(src)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// Select returns the data selected from datum.
+func (q *Query) Select(datum any) []any {
+	vals := q.SelectValue(macro.ValueOf(datum))
+	data := make([]any, len(vals))
+
+	for i, v := range vals {
+		data[i] = v.Datum
+	}
+
+	return data
+}
+
+// SelectValue returns the values selected from the document v, in document
+// order.
+func (q *Query) SelectValue(v macro.Value) []macro.Value {
+	return q.selectValue(v, true)
+}
+
+// selectValue applies q to v, which is the document root if root is set.
+func (q *Query) selectValue(v macro.Value, root bool) []macro.Value {
+	vals := []macro.Value{v}
+
+	for _, s := range q.steps {
+		var next []macro.Value
+
+		for _, v := range vals {
+			next = s.apply(next, v, root)
+		}
+
+		vals, root = next, false
+	}
+
+	return vals
+}
+
+type step interface {
+	apply(dst []macro.Value, v macro.Value, root bool) []macro.Value
+}
+
+type headStep struct {
+	head macro.Symbol
+}
+
+type childStep struct{}
+
+type descendantStep struct{}
+
+type indexStep struct {
+	index int
+}
+
+type keyStep struct {
+	keys []any
+}
+
+type patternStep struct {
+	pattern *match.Pattern
+	marked  bool
+}
+
+type predicateStep struct {
+	query *Query
+}
+
+func compile(s any) (step, error) {
+	switch v := s.(type) {
+	case macro.Symbol:
+		switch {
+		case v == "*":
+			return childStep{}, nil
+
+		case v == "**":
+			return descendantStep{}, nil
+
+		case strings.HasPrefix(string(v), ":") && len(v) > 1:
+			return keyStep{[]any{v, v[1:]}}, nil
+		}
+
+		return headStep{v}, nil
+
+	case int:
+		return indexStep{v}, nil
+
+	case string:
+		return keyStep{[]any{v, macro.Symbol(v)}}, nil
+
+	case []any:
+		if len(v) > 0 && v[0] == macro.Symbol("?") {
+			if len(v) == 1 {
+				return nil, fmt.Errorf("missing query in predicate")
+			}
+
+			q, err := Compile(v[1:])
+
+			if err != nil {
+				return nil, err
+			}
+
+			return predicateStep{q}, nil
+		}
+
+		pattern, marked := mark(v)
+		p, err := match.Compile(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return patternStep{p, marked}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported query step: %v", s)
+}
+
+// mark replaces the first ? in a pattern with the selection variable.
+func mark(pattern any) (any, bool) {
+	switch v := pattern.(type) {
+	case macro.Symbol:
+		if v == "?" {
+			return macro.Symbol(selection), true
+		}
+
+	case []any:
+		for i, elem := range v {
+			if marked, ok := mark(elem); ok {
+				list := append([]any(nil), v...)
+				list[i] = marked
+				return list, true
+			}
+		}
+
+	case macro.Pair:
+		if car, ok := mark(v.Car); ok {
+			return macro.Pair{Car: car, Cdr: v.Cdr}, true
+		}
+
+		if cdr, ok := mark(v.Cdr); ok {
+			return macro.Pair{Car: v.Car, Cdr: cdr}, true
+		}
+	}
+
+	return pattern, false
+}
+
+func (s headStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	for _, child := range children(v, root) {
+		if head, err := child.Head(); err == nil && head == s.head {
+			dst = append(dst, child)
+		}
+	}
+
+	return dst
+}
+
+func (s childStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	return append(dst, children(v, root)...)
+}
+
+func (s descendantStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	dst = append(dst, v)
+
+	for _, child := range children(v, root) {
+		dst = s.apply(dst, child, false)
+	}
+
+	return dst
+}
+
+func (s indexStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	n, err := v.Len()
+
+	if err != nil {
+		return dst
+	}
+
+	i := s.index
+
+	if i < 0 {
+		i += n
+	}
+
+	if item, err := v.Index(i); err == nil {
+		dst = append(dst, item)
+	}
+
+	return dst
+}
+
+func (s keyStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	dict, err := dictOf(v)
+
+	if err != nil {
+		return dst
+	}
+
+	for _, key := range s.keys {
+		if val, ok := dict.Get(key); ok {
+			return append(dst, val)
+		}
+	}
+
+	return dst
+}
+
+func (s patternStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	for _, child := range children(v, root) {
+		b, ok := s.pattern.MatchValue(child)
+
+		if !ok {
+			continue
+		}
+
+		if s.marked {
+			dst = append(dst, b[selection[1:]])
+		} else {
+			dst = append(dst, child)
+		}
+	}
+
+	return dst
+}
+
+func (s predicateStep) apply(dst []macro.Value, v macro.Value, root bool) []macro.Value {
+	if len(s.query.selectValue(v, false)) > 0 {
+		dst = append(dst, v)
+	}
+
+	return dst
+}
+
+// children returns the children of v. Those of the document root include
+// its first element, which is not a form head.
+func children(v macro.Value, root bool) []macro.Value {
+	if dict, err := dictOf(v); err == nil {
+		var vals []macro.Value
+
+		for _, val := range dict.All() {
+			vals = append(vals, val)
+		}
+
+		return vals
+	}
+
+	items, err := v.List()
+
+	if err != nil {
+		return nil
+	}
+
+	if len(items) > 0 && !root {
+		if _, ok := items[0].Datum.(macro.Symbol); ok {
+			return items[1:]
+		}
+	}
+
+	return items
+}
+
+// dictOf returns the entries of v if it is a dict, without reporting errors
+// for values of other shapes.
+func dictOf(v macro.Value) (*macro.Dict[macro.Value], error) {
+	switch v.Datum.(type) {
+	case *macro.Dict[any], map[any]any:
+		return v.Dict()
+	}
+
+	if head, err := v.Head(); err != nil || head != "dict" {
+		return nil, fmt.Errorf("%s not a dict", v.Pos)
+	}
+
+	return v.Dict()
+}
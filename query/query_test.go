@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package query
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mowen132/macro"
+)
+
+// document decodes the top-level forms of src into a list, as sexpq does.
+func document(t *testing.T, src string) macro.Value {
+	t.Helper()
+	d := macro.NewDecoder(strings.NewReader(src))
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			return macro.ListOf(forms...)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forms = append(forms, v)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	doc := document(t, `
+		alpha beta
+		(server web (listen https 443) (port 80))
+		(server api (port 8080))
+		{name "x" port 1}
+	`)
+
+	tests := []struct {
+		query string
+		want  []any
+	}{
+		{"*", []any{
+			macro.Symbol("alpha"),
+			macro.Symbol("beta"),
+			[]any{macro.Symbol("server"), macro.Symbol("web"), []any{macro.Symbol("listen"), macro.Symbol("https"), 443}, []any{macro.Symbol("port"), 80}},
+			[]any{macro.Symbol("server"), macro.Symbol("api"), []any{macro.Symbol("port"), 8080}},
+			[]any{macro.Symbol("dict"), macro.Symbol("name"), "x", macro.Symbol("port"), 1},
+		}},
+		{"(0)", []any{macro.Symbol("alpha")}},
+		{"(server 0)", []any{macro.Symbol("server"), macro.Symbol("server")}},
+		{"(server port *)", []any{80, 8080}},
+		{"(server (port ?))", []any{80, 8080}},
+		{"(server (? listen) 1)", []any{macro.Symbol("web")}},
+		{"(** (port ?))", []any{80, 8080}},
+		{"(-1 :name)", []any{"x"}},
+		{`(-1 "port")`, []any{1}},
+	}
+
+	for _, test := range tests {
+		got := MustParse(test.query).SelectValue(doc)
+		data := make([]any, len(got))
+
+		for i, v := range got {
+			data[i] = v.Datum
+		}
+
+		if !macro.Equal(data, test.want) {
+			t.Errorf("%s selected %#v, want %#v", test.query, data, test.want)
+		}
+	}
+}
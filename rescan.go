@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edit replaces the bytes of a source from offset Start up to offset End
+// with Text.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Rescan returns the tokens of src, the source after edit, given the tokens
+// old of the source before it, as returned by a Scanner up to and including
+// TokenEnd. opts should be that Scanner's Options, so that the macros and
+// tags registered with it are recognized when rescanning.
+//
+// Rather than scanning all of src, Rescan restarts at the last line start
+// before the edit, which lies outside any string or comment, and stops once
+// a token after the edit starts a line at the same place as an old token.
+// From there the old tokens are reused, shifted by the lines and bytes the
+// edit added or removed. On a scanning error it returns the tokens before
+// the error along with the error.
+func Rescan(src string, old []*Token, edit Edit, opts ScannerOptions) ([]*Token, error) {
+	// The old source ends where its TokenEnd starts.
+	size := len(src) - len(edit.Text) + edit.End - edit.Start
+
+	if n := len(old); n > 0 && old[n-1].Kind == TokenEnd && old[n-1].Pos.Offset != size {
+		return nil, fmt.Errorf("edit of [%d, %d) with %d bytes does not turn %d bytes into %d", edit.Start, edit.End, len(edit.Text), old[n-1].Pos.Offset, len(src))
+	}
+
+	if edit.Start < 0 || edit.End < edit.Start || edit.End > size {
+		return nil, fmt.Errorf("invalid edit of [%d, %d) with %d bytes of a %d-byte source", edit.Start, edit.End, len(edit.Text), size)
+	}
+
+	// Scanning restarts at the last token at a line start before the edit,
+	// or at the start of the source. Tokens before it are kept as they are.
+	i := 0
+	opts.Start = Position{Line: 1, Col: 1}
+
+	for j, tok := range old {
+		if tok.Pos.Offset > edit.Start {
+			break
+		}
+
+		if tok.Pos.Col == 1 {
+			i, opts.Start = j, tok.Pos
+		}
+	}
+
+	tokens := append([]*Token{}, old[:i]...)
+	s := NewScannerWithOptions(strings.NewReader(src[opts.Start.Offset:]), opts)
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	// j is the first old token that may start at the same place as the
+	// token just scanned.
+	j := i
+
+	for {
+		tok, err := s.Scan()
+
+		if err != nil {
+			return tokens, err
+		}
+
+		for j < len(old) && old[j].Pos.Offset < tok.Pos.Offset-delta {
+			j++
+		}
+
+		if tok.Pos.Col == 1 && tok.Pos.Offset-delta >= edit.End && j < len(old) && sameToken(tok, old[j], delta) {
+			lines := tok.Pos.Line - old[j].Pos.Line
+
+			if lines == 0 && delta == 0 {
+				return append(tokens, old[j:]...), nil
+			}
+
+			shifted := make([]Token, len(old)-j)
+
+			for k, o := range old[j:] {
+				shifted[k] = Token{o.Kind, o.Val, o.Pos.shift(lines, delta), o.End.shift(lines, delta)}
+				tokens = append(tokens, &shifted[k])
+			}
+
+			return tokens, nil
+		}
+
+		tokens = append(tokens, tok)
+
+		if tok.Kind == TokenEnd {
+			return tokens, nil
+		}
+	}
+}
+
+// sameToken reports whether tok, scanned from the edited source, is old
+// moved by delta bytes.
+func sameToken(tok, old *Token, delta int) bool {
+	return tok.Kind == old.Kind && tok.Val == old.Val && old.Pos.Col == 1 &&
+		tok.Pos.Offset == old.Pos.Offset+delta && tok.End.Offset == old.End.Offset+delta
+}
+
+func (p Position) shift(lines, bytes int) Position {
+	p.Line += lines
+	p.Offset += bytes
+	return p
+}
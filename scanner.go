@@ -7,8 +7,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -16,22 +19,128 @@ const (
 	eof = -2
 )
 
+type ScannerOptions struct {
+	// File names the source in every Position reported by the Scanner.
+	File string
+
+	// Columns selects the unit counted by Position.Col.
+	Columns ColumnUnit
+
+	// Relaxed allows a token to be followed directly by an opening delimiter,
+	// a string or a quote prefix, as in (a)(b) or '(a)'b. By default such
+	// tokens must be separated by whitespace.
+	Relaxed bool
+
+	// SymbolStart and SymbolChar report whether a character may begin or
+	// continue a symbol, defaulting to DefaultSymbolStart and
+	// DefaultSymbolChar. Characters with syntax of their own, such as digits,
+	// signs, delimiters and quotes, cannot begin a symbol.
+	SymbolStart func(c rune) bool
+	SymbolChar  func(c rune) bool
+
+	// FoldCase converts unquoted symbols to lower case.
+	FoldCase bool
+
+	// QuotedSymbols reads |...| as a symbol of arbitrary characters, with
+	// the escapes of strings. By default '|' is an ordinary symbol character.
+	QuotedSymbols bool
+
+	// MaxTokenBytes limits the size of a single token, such as a string or a
+	// run of whitespace. Zero means no limit.
+	MaxTokenBytes int
+
+	// Start is the position of the first character read, for scanning the
+	// rest of a source from a point within it. Positions start at line 1,
+	// column 1 when Start.Line is zero. Start.File is replaced by File.
+	Start Position
+
+	// Macros and Tags are registered as by RegisterMacro and RegisterTag.
+	Macros []string
+	Tags   []string
+}
+
 type Scanner struct {
+	opts   ScannerOptions
 	reader *bufio.Reader
 	char   rune
+	size   int
 	pos    Position
 	buf    strings.Builder
+	macros []string
+	tags   map[string]bool
 }
 
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{
+	return NewScannerWithOptions(r, ScannerOptions{})
+}
+
+func NewScannerWithOptions(r io.Reader, opts ScannerOptions) *Scanner {
+	pos := Position{opts.File, 1, 1, 0}
+
+	if opts.Start.Line > 0 {
+		pos = opts.Start
+		pos.File = opts.File
+	}
+
+	s := &Scanner{
+		opts:   opts,
 		reader: bufio.NewReader(r),
 		char:   bof,
-		pos:    Position{1, 0},
+		pos:    pos,
+		tags:   map[string]bool{},
+	}
+
+	for _, prefix := range opts.Macros {
+		s.RegisterMacro(prefix)
+	}
+
+	for _, tag := range opts.Tags {
+		s.RegisterTag(tag)
+	}
+
+	return s
+}
+
+// Options returns the options of s, including the macros and tags
+// registered since it was created, for creating a scanner that scans the
+// same way, as Rescan does.
+func (s *Scanner) Options() ScannerOptions {
+	opts := s.opts
+	opts.Macros = slices.Clone(s.macros)
+	opts.Tags = slices.Sorted(maps.Keys(s.tags))
+	return opts
+}
+
+// RegisterMacro makes Scan report prefix as a TokenMacro wherever a token
+// starts with it, taking precedence over the built-in syntax.
+func (s *Scanner) RegisterMacro(prefix string) {
+	if prefix == "" || slices.Contains(s.macros, prefix) {
+		return
+	}
+
+	s.macros = append(s.macros, prefix)
+
+	slices.SortFunc(s.macros, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+// RegisterTag makes Scan report #tag as a TokenTag, to be followed by the
+// tagged datum. Unregistered names, and registered ones directly before a
+// closing delimiter or the end of input, scan as symbols such as #t.
+func (s *Scanner) RegisterTag(tag string) {
+	if tag != "" {
+		s.tags[s.fold(tag)] = true
 	}
 }
 
 func (s *Scanner) Scan() (*Token, error) {
+	if s.char >= 0 && len(s.macros) > 0 {
+		if prefix, ok := s.matchMacro(); ok {
+			return s.scanMacro(prefix)
+		}
+	}
+
 	switch s.char {
 	case bof:
 		if err := s.read(); err != nil {
@@ -47,6 +156,10 @@ func (s *Scanner) Scan() (*Token, error) {
 			return nil, err
 		}
 
+		if s.atDelimiter() {
+			return s.token(TokenSymbol, s.extract(), pos), nil
+		}
+
 		switch s.char {
 		case '0':
 			return s.scanZero(pos)
@@ -54,25 +167,11 @@ func (s *Scanner) Scan() (*Token, error) {
 		case '1', '2', '3', '4', '5', '6', '7', '8', '9':
 			return s.scanDigit(pos)
 
-		case '!', '#', '$', '%', '&', '*', '+', '-', '/', ':',
-			'<', '=', '>', '?', '@', 'A', 'B', 'C', 'D', 'E',
-			'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
-			'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y',
-			'Z', '\\', '^', '_', 'a', 'b', 'c', 'd', 'e', 'f',
-			'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o', 'p',
-			'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
-			'|', '~':
-
-			return s.scanSymbol(pos)
-
 		case '.':
 			return s.scanDot(pos)
 
-		case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-			return &Token{TokenSymbol, s.extract(), pos}, nil
-
 		default:
-			if unicode.IsLetter(s.char) {
+			if s.isSymbolChar(s.char) {
 				return s.scanSymbol(pos)
 			}
 
@@ -86,85 +185,50 @@ func (s *Scanner) Scan() (*Token, error) {
 		return s.scanDigit(s.pos)
 
 	case '"':
+		return s.scanQuoted(TokenString, '"')
+
+	case '#':
 		pos := s.pos
 
-		for {
+		switch next := s.peek(); {
+		case next == '{':
 			if err := s.read(); err != nil {
 				return nil, err
 			}
 
-			switch s.char {
-			case '"':
-				if err := s.read(); err != nil {
-					return nil, err
-				}
-
-				switch s.char {
-				case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-					return &Token{TokenString, s.extract(), pos}, nil
-
-				default:
-					return nil, s.errorUnexpectedf("%q after closing '\"'", s.char)
-				}
-
-			case '\\':
-				if err := s.read(); err != nil {
-					return nil, err
-				}
-
-				switch s.char {
-				case '"':
-					s.buf.WriteRune('"')
-
-				case '\\':
-					s.buf.WriteRune('\\')
-
-				case 'b':
-					s.buf.WriteRune('\b')
-
-				case 'f':
-					s.buf.WriteRune('\f')
-
-				case 'n':
-					s.buf.WriteRune('\n')
-
-				case 'r':
-					s.buf.WriteRune('\r')
-
-				case 't':
-					s.buf.WriteRune('\t')
+			if err := s.read(); err != nil {
+				return nil, err
+			}
 
-				case eof:
-					return nil, s.errorUnexpectedf("eof in escape sequence")
+			return s.token(TokenLeftSet, "", pos), nil
 
-				default:
-					return nil, s.errorUnexpectedf("%q in escape sequence", s.char)
-				}
+		case unicode.IsLetter(next):
+			if err := s.read(); err != nil {
+				return nil, err
+			}
 
-			case '\x00', '\x01', '\x02', '\x03', '\x04', '\x05', '\x06', '\a', '\b', '\n',
-				'\v', '\f', '\r', '\x0e', '\x0f', '\x10', '\x11', '\x12', '\x13', '\x14',
-				'\x15', '\x16', '\x17', '\x18', '\x19', '\x1a', '\x1b', '\x1c', '\x1d', '\x1e',
-				'\x1f', '\x7f':
+			tok, err := s.scanSymbol(pos)
 
-				return nil, s.errorUnexpectedf("%q in string", s.char)
+			if err != nil {
+				return nil, err
+			}
 
-			case eof:
-				return nil, s.errorUnexpectedf("eof in string")
+			switch s.char {
+			case ')', ']', '}', eof:
 
 			default:
-				s.buf.WriteRune(s.char)
+				if s.tags[tok.Val] {
+					tok.Kind = TokenTag
+					return tok, nil
+				}
 			}
-		}
 
-	case '!', '#', '$', '%', '&', '*', '/', ':', '<', '=',
-		'>', '?', '@', 'A', 'B', 'C', 'D', 'E', 'F', 'G',
-		'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O', 'P', 'Q',
-		'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '\\',
-		'^', '_', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h',
-		'i', 'j', 'k', 'l', 'm', 'n', 'o', 'p', 'q', 'r',
-		's', 't', 'u', 'v', 'w', 'x', 'y', 'z', '|', '~':
+			tok.Val = "#" + tok.Val
+			return tok, nil
 
-		return s.scanSymbol(s.pos)
+		default:
+			return s.scanSymbol(pos)
+		}
 
 	case '.':
 		return s.scanDot(s.pos)
@@ -209,7 +273,7 @@ func (s *Scanner) Scan() (*Token, error) {
 				continue
 
 			default:
-				return &Token{TokenWhitespace, s.extract(), pos}, nil
+				return s.token(TokenWhitespace, s.extract(), pos), nil
 			}
 		}
 
@@ -223,7 +287,7 @@ func (s *Scanner) Scan() (*Token, error) {
 
 			switch s.char {
 			case '\n', '\r', eof:
-				return &Token{TokenComment, s.extract(), pos}, nil
+				return s.token(TokenComment, s.extract(), pos), nil
 
 			case '\x00', '\x01', '\x02', '\x03', '\x04', '\x05', '\x06', '\a', '\b', '\v',
 				'\f', '\x0e', '\x0f', '\x10', '\x11', '\x12', '\x13', '\x14', '\x15', '\x16',
@@ -232,7 +296,9 @@ func (s *Scanner) Scan() (*Token, error) {
 				return nil, s.errorUnexpectedf("%q in comment", s.char)
 
 			default:
-				s.buf.WriteRune(s.char)
+				if err := s.write(s.char); err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -240,13 +306,19 @@ func (s *Scanner) Scan() (*Token, error) {
 		return s.scanSingle(TokenNewline)
 
 	case '\r':
+		pos := s.pos
+
 		if err := s.read(); err != nil {
 			return nil, err
 		}
 
 		switch s.char {
 		case '\n':
-			return s.scanSingle(TokenNewline)
+			if err := s.read(); err != nil {
+				return nil, err
+			}
+
+			return s.token(TokenNewline, "", pos), nil
 
 		case eof:
 			return nil, s.errorUnexpectedf("eof after '\r'")
@@ -256,10 +328,17 @@ func (s *Scanner) Scan() (*Token, error) {
 		}
 
 	case eof:
-		return &Token{TokenEnd, "", s.pos}, nil
+		return s.token(TokenEnd, "", s.pos), nil
+
+	case '|':
+		if s.opts.QuotedSymbols {
+			return s.scanQuoted(TokenSymbol, '|')
+		}
+
+		fallthrough
 
 	default:
-		if unicode.IsLetter(s.char) {
+		if s.isSymbolStart(s.char) {
 			return s.scanSymbol(s.pos)
 		}
 
@@ -267,11 +346,125 @@ func (s *Scanner) Scan() (*Token, error) {
 	}
 }
 
+func (s *Scanner) scanQuoted(kind TokenKind, quote rune) (*Token, error) {
+	pos := s.pos
+
+	for {
+		if err := s.read(); err != nil {
+			return nil, err
+		}
+
+		switch s.char {
+		case quote:
+			if err := s.read(); err != nil {
+				return nil, err
+			}
+
+			if !s.atDelimiter() {
+				return nil, s.errorUnexpectedf("%q after closing %q", s.char, quote)
+			}
+
+			return s.token(kind, s.extract(), pos), nil
+
+		case '\\':
+			if err := s.read(); err != nil {
+				return nil, err
+			}
+
+			var c rune
+
+			switch s.char {
+			case '"', '|':
+				c = s.char
+
+			case '\\':
+				c = '\\'
+
+			case 'b':
+				c = '\b'
+
+			case 'f':
+				c = '\f'
+
+			case 'n':
+				c = '\n'
+
+			case 'r':
+				c = '\r'
+
+			case 't':
+				c = '\t'
+
+			case 'u':
+				for range 4 {
+					if err := s.read(); err != nil {
+						return nil, err
+					}
+
+					switch {
+					case s.char >= '0' && s.char <= '9':
+						c = c<<4 | (s.char - '0')
+
+					case s.char >= 'a' && s.char <= 'f':
+						c = c<<4 | (s.char - 'a' + 10)
+
+					case s.char >= 'A' && s.char <= 'F':
+						c = c<<4 | (s.char - 'A' + 10)
+
+					case s.char == eof:
+						return nil, s.errorUnexpectedf("eof in escape sequence")
+
+					default:
+						return nil, s.errorUnexpectedf("%q in escape sequence", s.char)
+					}
+				}
+
+			case eof:
+				return nil, s.errorUnexpectedf("eof in escape sequence")
+
+			default:
+				return nil, s.errorUnexpectedf("%q in escape sequence", s.char)
+			}
+
+			if err := s.write(c); err != nil {
+				return nil, err
+			}
+
+		case '\x00', '\x01', '\x02', '\x03', '\x04', '\x05', '\x06', '\a', '\b', '\n',
+			'\v', '\f', '\r', '\x0e', '\x0f', '\x10', '\x11', '\x12', '\x13', '\x14',
+			'\x15', '\x16', '\x17', '\x18', '\x19', '\x1a', '\x1b', '\x1c', '\x1d', '\x1e',
+			'\x1f', '\x7f':
+
+			return nil, s.errorUnexpectedf("%q in %s", s.char, quotedName(kind))
+
+		case eof:
+			return nil, s.errorUnexpectedf("eof in %s", quotedName(kind))
+
+		default:
+			if err := s.write(s.char); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func quotedName(kind TokenKind) string {
+	if kind == TokenSymbol {
+		return "symbol"
+	}
+
+	return "string"
+}
+
 func (s *Scanner) scanZero(pos Position) (*Token, error) {
 	if err := s.consume(); err != nil {
 		return nil, err
 	}
 
+	if s.atDelimiter() {
+		return s.token(TokenInt, s.extract(), pos), nil
+	}
+
 	switch s.char {
 	case '.':
 		return s.scanDecimal(pos)
@@ -279,9 +472,6 @@ func (s *Scanner) scanZero(pos Position) (*Token, error) {
 	case 'e', 'E':
 		return s.scanExponent(pos)
 
-	case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-		return &Token{TokenInt, s.extract(), pos}, nil
-
 	default:
 		return nil, s.errorUnexpectedf("%q after '0'", s.char)
 	}
@@ -293,6 +483,10 @@ func (s *Scanner) scanDigit(pos Position) (*Token, error) {
 			return nil, err
 		}
 
+		if s.atDelimiter() {
+			return s.token(TokenInt, s.extract(), pos), nil
+		}
+
 		switch s.char {
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 			continue
@@ -303,9 +497,6 @@ func (s *Scanner) scanDigit(pos Position) (*Token, error) {
 		case 'e', 'E':
 			return s.scanExponent(pos)
 
-		case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-			return &Token{TokenInt, s.extract(), pos}, nil
-
 		default:
 			return nil, s.errorUnexpectedf("%q after digit", s.char)
 		}
@@ -324,6 +515,10 @@ func (s *Scanner) scanDecimal(pos Position) (*Token, error) {
 				return nil, err
 			}
 
+			if s.atDelimiter() {
+				return s.token(TokenFloat, s.extract(), pos), nil
+			}
+
 			switch s.char {
 			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 				continue
@@ -331,9 +526,6 @@ func (s *Scanner) scanDecimal(pos Position) (*Token, error) {
 			case 'e', 'E':
 				return s.scanExponent(pos)
 
-			case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-				return &Token{TokenFloat, s.extract(), pos}, nil
-
 			default:
 				return nil, s.errorUnexpectedf("%q in decimal", s.char)
 			}
@@ -384,15 +576,16 @@ func (s *Scanner) scanExponent(pos Position) (*Token, error) {
 	}
 
 	for {
+		if s.atDelimiter() {
+			return s.token(TokenFloat, s.extract(), pos), nil
+		}
+
 		switch s.char {
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 			if err := s.consume(); err != nil {
 				return nil, err
 			}
 
-		case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-			return &Token{TokenFloat, s.extract(), pos}, nil
-
 		default:
 			return nil, s.errorUnexpectedf("%q in exponent", s.char)
 		}
@@ -405,29 +598,15 @@ func (s *Scanner) scanSymbol(pos Position) (*Token, error) {
 			return nil, err
 		}
 
-		switch s.char {
-		case '!', '#', '$', '%', '&', '*', '+', '-', '.', '/',
-			'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
-			':', '<', '=', '>', '?', '@', 'A', 'B', 'C', 'D',
-			'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N',
-			'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X',
-			'Y', 'Z', '\\', '^', '_', 'a', 'b', 'c', 'd', 'e',
-			'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
-			'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y',
-			'z', '|', '~':
-
+		if s.isSymbolChar(s.char) {
 			continue
+		}
 
-		case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-			return &Token{TokenSymbol, s.extract(), pos}, nil
-
-		default:
-			if unicode.IsLetter(s.char) || unicode.IsDigit(s.char) {
-				continue
-			}
-
-			return nil, s.errorUnexpectedf("%q in symbol", s.char)
+		if s.atDelimiter() {
+			return s.token(TokenSymbol, s.fold(s.extract()), pos), nil
 		}
+
+		return nil, s.errorUnexpectedf("%q in symbol", s.char)
 	}
 }
 
@@ -437,30 +616,92 @@ func (s *Scanner) scanDot(pos Position) (*Token, error) {
 	}
 
 	switch s.char {
-	case '!', '#', '$', '%', '&', '*', '+', '-', '.', '/',
-		':', '<', '=', '>', '?', '@', 'A', 'B', 'C', 'D',
-		'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N',
-		'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X',
-		'Y', 'Z', '\\', '^', '_', 'a', 'b', 'c', 'd', 'e',
-		'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
-		'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y',
-		'z', '|', '~':
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return nil, s.errorUnexpectedf("digit after '.'")
+	}
 
+	if s.isSymbolChar(s.char) {
 		return s.scanSymbol(pos)
+	}
+
+	if s.atDelimiter() {
+		val := s.extract()
+
+		if val == "." {
+			return s.token(TokenDot, "", pos), nil
+		}
+
+		return s.token(TokenSymbol, val, pos), nil
+	}
+
+	return nil, s.errorUnexpectedf("%q in symbol", s.char)
+}
+
+func (s *Scanner) isSymbolStart(c rune) bool {
+	if s.opts.SymbolStart != nil {
+		return s.opts.SymbolStart(c)
+	}
+
+	return DefaultSymbolStart(c)
+}
+
+func (s *Scanner) isSymbolChar(c rune) bool {
+	if s.opts.SymbolChar != nil {
+		return s.opts.SymbolChar(c)
+	}
+
+	return DefaultSymbolChar(c)
+}
 
+func (s *Scanner) fold(val string) string {
+	if s.opts.FoldCase {
+		return strings.ToLower(val)
+	}
+
+	return val
+}
+
+func (s *Scanner) atDelimiter() bool {
+	switch s.char {
 	case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-		return &Token{TokenSymbol, s.extract(), pos}, nil
+		return true
 
-	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		return nil, s.errorUnexpectedf("digit after '.'")
+	case '(', '[', '{', '"', '\'', '`', ',':
+		return s.opts.Relaxed
 
-	default:
-		if unicode.IsLetter(s.char) {
-			return s.scanSymbol(pos)
+	case '#':
+		return s.opts.Relaxed && s.peek() == '{'
+	}
+
+	return false
+}
+
+func (s *Scanner) matchMacro() (string, bool) {
+	for _, prefix := range s.macros {
+		c, n := utf8.DecodeRuneInString(prefix)
+
+		if c != s.char {
+			continue
 		}
 
-		return nil, s.errorUnexpectedf("%q in symbol", s.char)
+		if b, _ := s.reader.Peek(len(prefix) - n); string(b) == prefix[n:] {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *Scanner) scanMacro(prefix string) (*Token, error) {
+	pos := s.pos
+
+	for range utf8.RuneCountInString(prefix) {
+		if err := s.read(); err != nil {
+			return nil, err
+		}
 	}
+
+	return s.token(TokenMacro, prefix, pos), nil
 }
 
 func (s *Scanner) scanSingle(kind TokenKind) (*Token, error) {
@@ -470,7 +711,7 @@ func (s *Scanner) scanSingle(kind TokenKind) (*Token, error) {
 		return nil, err
 	}
 
-	return &Token{kind, "", pos}, nil
+	return s.token(kind, "", pos), nil
 }
 
 func (s *Scanner) scanSingleTerm(kind TokenKind) (*Token, error) {
@@ -481,17 +722,24 @@ func (s *Scanner) scanSingleTerm(kind TokenKind) (*Token, error) {
 		return nil, err
 	}
 
-	switch s.char {
-	case ')', ']', '}', ' ', '\t', ';', '\n', '\r', eof:
-		return &Token{kind, "", pos}, nil
-
-	default:
+	if !s.atDelimiter() {
 		return nil, s.errorUnexpectedf("%q after %q", s.char, char)
 	}
+
+	return s.token(kind, "", pos), nil
 }
 
 func (s *Scanner) read() error {
-	c, _, err := s.reader.ReadRune()
+	if s.char == '\n' {
+		s.pos.Line++
+		s.pos.Col = 1
+	} else {
+		s.pos.Col += s.opts.Columns.width(s.char, s.size)
+	}
+
+	s.pos.Offset += s.size
+
+	c, size, err := s.reader.ReadRune()
 
 	if err != nil {
 		if err != io.EOF {
@@ -502,22 +750,42 @@ func (s *Scanner) read() error {
 	}
 
 	s.char = c
+	s.size = size
+	return nil
+}
 
-	if c == '\n' {
-		s.pos.Line++
-		s.pos.Col = 0
-	} else {
-		s.pos.Col++
+func (s *Scanner) peek() rune {
+	b, _ := s.reader.Peek(utf8.UTFMax)
+
+	if len(b) == 0 {
+		return eof
 	}
 
-	return nil
+	c, _ := utf8.DecodeRune(b)
+	return c
 }
 
 func (s *Scanner) consume() error {
-	s.buf.WriteRune(s.char)
+	if err := s.write(s.char); err != nil {
+		return err
+	}
+
 	return s.read()
 }
 
+func (s *Scanner) write(c rune) error {
+	if max := s.opts.MaxTokenBytes; max > 0 && s.buf.Len()+utf8.RuneLen(c) > max {
+		return &LimitError{"token size", max, s.pos}
+	}
+
+	s.buf.WriteRune(c)
+	return nil
+}
+
+func (s *Scanner) token(kind TokenKind, val string, pos Position) *Token {
+	return &Token{kind, val, pos, s.pos}
+}
+
 func (s *Scanner) extract() string {
 	val := s.buf.String()
 	s.buf.Reset()
@@ -0,0 +1,799 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+// Package schema validates decoded S-expressions against schemas that are
+// themselves written as S-expressions:
+//
+//	(root config)
+//	(define config (form config (rest (or server log))))
+//	(define server (form server string (optional (dict (key port int) (optional (key host string))))))
+//	(define log (form log (enum debug info error)))
+//
+// A schema is a sequence of (define name type) forms naming types, and one
+// (root type) form giving the type of each top-level form. The types are:
+//
+//	any int float number string symbol
+//	                                    atoms of that kind; number is int or float
+//	name                                the type defined as name
+//	(enum datum ...)                    one of the given data
+//	(form head type ... (optional type ...) (rest type))
+//	                                    a list headed by the symbol head, with
+//	                                    required, then optional, then any number
+//	                                    of further arguments
+//	(list-of type)                      a list, or [...] literal, of elements of type
+//	(set-of type)                       a #{...} literal of elements of type
+//	(dict (key k type) ... (optional (key k type) ...) (rest type))
+//	                                    a {...} literal with required, optional,
+//	                                    and if rest is given, other keys
+//	(or type ...)                       any of the types
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mowen132/macro"
+)
+
+type Schema struct {
+	root  typ
+	types map[macro.Symbol]typ
+}
+
+// Read decodes and compiles a schema. The file name is used in positions.
+func Read(r io.Reader, file string) (*Schema, error) {
+	d := macro.NewDecoderWithOptions(r, macro.DecoderOptions{
+		Scanner: macro.ScannerOptions{File: file},
+	})
+
+	var forms []macro.Value
+
+	for {
+		v, err := d.DecodeValue()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		forms = append(forms, v)
+	}
+
+	return Compile(forms...)
+}
+
+// Parse decodes and compiles a schema from src.
+func Parse(src string) (*Schema, error) {
+	return Read(strings.NewReader(src), "")
+}
+
+// MustParse is like Parse but panics if the schema is invalid.
+func MustParse(src string) *Schema {
+	s, err := Parse(src)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// Compile compiles the top-level forms of a schema.
+func Compile(forms ...macro.Value) (*Schema, error) {
+	c := &compiler{schema: &Schema{types: map[macro.Symbol]typ{}}}
+
+	for _, form := range forms {
+		if err := c.compileForm(form); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range c.refs {
+		if _, ok := c.schema.types[r.name]; !ok {
+			return nil, fmt.Errorf("%s undefined type %s", r.pos, r.name)
+		}
+	}
+
+	if err := c.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	if c.schema.root == nil {
+		return nil, fmt.Errorf("missing root in schema")
+	}
+
+	return c.schema, nil
+}
+
+// Validate checks v against the root type of s. It reports every mismatch
+// found, each prefixed with its position, joined with errors.Join.
+func Validate(v macro.Value, s *Schema) error {
+	var errs []error
+	s.root.validate(v, &errs)
+	return errors.Join(errs...)
+}
+
+type typ interface {
+	// accepts reports whether v has the shape of the type, without checking
+	// its elements. It selects the alternative of an or to report errors for.
+	accepts(v macro.Value) bool
+	validate(v macro.Value, errs *[]error)
+	String() string
+}
+
+type kind struct {
+	name string
+	test func(datum any) bool
+}
+
+type ref struct {
+	name   macro.Symbol
+	schema *Schema
+	pos    macro.Position
+}
+
+type enum struct {
+	data []any
+}
+
+type form struct {
+	head     macro.Symbol
+	required []typ
+	optional []typ
+	rest     typ
+}
+
+type listOf struct {
+	elem typ
+}
+
+type setOf struct {
+	elem typ
+}
+
+type dictKey struct {
+	key any
+	typ typ
+}
+
+type dict struct {
+	required []dictKey
+	optional []dictKey
+	rest     typ
+}
+
+type or struct {
+	alts []typ
+}
+
+var kinds = map[macro.Symbol]*kind{
+	"any":    {"any", func(any) bool { return true }},
+	"int":    {"int", isInt},
+	"float":  {"float", isFloat},
+	"number": {"number", func(datum any) bool { return isInt(datum) || isFloat(datum) }},
+	"string": {"string", isType[string]},
+	"symbol": {"symbol", isType[macro.Symbol]},
+}
+
+func isInt(datum any) bool {
+	_, ok := datum.(int)
+	return ok
+}
+
+func isFloat(datum any) bool {
+	_, ok := datum.(float64)
+	return ok
+}
+
+func isType[T any](datum any) bool {
+	_, ok := datum.(T)
+	return ok
+}
+
+type compiler struct {
+	schema *Schema
+	refs   []*ref
+}
+
+// checkCycles rejects a type that refers back to itself through names and
+// ors alone, which validation would follow forever without descending into
+// the value.
+func (c *compiler) checkCycles() error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := map[macro.Symbol]int{}
+	var visit func(t typ) error
+
+	visit = func(t typ) error {
+		switch t := t.(type) {
+		case *ref:
+			switch state[t.name] {
+			case visiting:
+				return fmt.Errorf("%s type %s refers to itself without an intervening form, list, set or dict", t.pos, t.name)
+
+			case visited:
+				return nil
+			}
+
+			state[t.name] = visiting
+
+			if err := visit(c.schema.types[t.name]); err != nil {
+				return err
+			}
+
+			state[t.name] = visited
+
+		case *or:
+			for _, alt := range t.alts {
+				if err := visit(alt); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for _, r := range c.refs {
+		if err := visit(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) compileForm(v macro.Value) error {
+	head, err := v.Head()
+
+	if err != nil {
+		return err
+	}
+
+	args, _ := v.Args()
+
+	switch head {
+	case "define":
+		if len(args) != 2 {
+			return fmt.Errorf("%s expected (define name type)", v.Pos)
+		}
+
+		name, err := args[0].AsSymbol()
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := kinds[name]; ok {
+			return fmt.Errorf("%s cannot redefine %s", args[0].Pos, name)
+		}
+
+		if _, ok := c.schema.types[name]; ok {
+			return fmt.Errorf("%s duplicate definition of %s", args[0].Pos, name)
+		}
+
+		t, err := c.compileType(args[1])
+
+		if err != nil {
+			return err
+		}
+
+		c.schema.types[name] = t
+
+	case "root":
+		if len(args) != 1 {
+			return fmt.Errorf("%s expected (root type)", v.Pos)
+		}
+
+		if c.schema.root != nil {
+			return fmt.Errorf("%s duplicate root", v.Pos)
+		}
+
+		t, err := c.compileType(args[0])
+
+		if err != nil {
+			return err
+		}
+
+		c.schema.root = t
+
+	default:
+		return fmt.Errorf("%s unexpected (%s ...) in schema", v.Pos, head)
+	}
+
+	return nil
+}
+
+func (c *compiler) compileType(v macro.Value) (typ, error) {
+	if name, err := v.AsSymbol(); err == nil {
+		if k, ok := kinds[name]; ok {
+			return k, nil
+		}
+
+		r := &ref{name, c.schema, v.Pos}
+		c.refs = append(c.refs, r)
+		return r, nil
+	}
+
+	head, err := v.Head()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s expected type, got %v", v.Pos, v.Datum)
+	}
+
+	args, _ := v.Args()
+
+	switch head {
+	case "enum":
+		e := &enum{}
+
+		for _, arg := range args {
+			e.data = append(e.data, arg.Datum)
+		}
+
+		return e, nil
+
+	case "form":
+		return c.compileFormType(v, args)
+
+	case "list-of", "set-of":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expected (%s type)", v.Pos, head)
+		}
+
+		elem, err := c.compileType(args[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if head == "set-of" {
+			return &setOf{elem}, nil
+		}
+
+		return &listOf{elem}, nil
+
+	case "dict":
+		return c.compileDict(args)
+
+	case "or":
+		o := &or{}
+
+		for _, arg := range args {
+			t, err := c.compileType(arg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			o.alts = append(o.alts, t)
+		}
+
+		return o, nil
+	}
+
+	return nil, fmt.Errorf("%s unknown type (%s ...)", v.Pos, head)
+}
+
+func (c *compiler) compileFormType(v macro.Value, args []macro.Value) (typ, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s expected (form head type ...)", v.Pos)
+	}
+
+	head, err := args[0].AsSymbol()
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &form{head: head}
+
+	for _, arg := range args[1:] {
+		switch h, _ := arg.Head(); h {
+		case "optional":
+			if f.optional != nil || f.rest != nil {
+				return nil, fmt.Errorf("%s unexpected (optional ...)", arg.Pos)
+			}
+
+			opts, _ := arg.Args()
+			f.optional = []typ{}
+
+			for _, opt := range opts {
+				t, err := c.compileType(opt)
+
+				if err != nil {
+					return nil, err
+				}
+
+				f.optional = append(f.optional, t)
+			}
+
+		case "rest":
+			if f.rest != nil {
+				return nil, fmt.Errorf("%s unexpected (rest ...)", arg.Pos)
+			}
+
+			if n, _ := arg.Len(); n != 2 {
+				return nil, fmt.Errorf("%s expected (rest type)", arg.Pos)
+			}
+
+			elem, _ := arg.Index(1)
+
+			if f.rest, err = c.compileType(elem); err != nil {
+				return nil, err
+			}
+
+		default:
+			if f.optional != nil || f.rest != nil {
+				return nil, fmt.Errorf("%s required argument after optional arguments", arg.Pos)
+			}
+
+			t, err := c.compileType(arg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			f.required = append(f.required, t)
+		}
+	}
+
+	return f, nil
+}
+
+func (c *compiler) compileDict(args []macro.Value) (typ, error) {
+	d := &dict{}
+
+	for _, arg := range args {
+		switch h, _ := arg.Head(); h {
+		case "key":
+			if d.optional != nil || d.rest != nil {
+				return nil, fmt.Errorf("%s required key after optional keys", arg.Pos)
+			}
+
+			k, err := c.compileKey(arg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.required = append(d.required, k)
+
+		case "optional":
+			if d.optional != nil || d.rest != nil {
+				return nil, fmt.Errorf("%s unexpected (optional ...)", arg.Pos)
+			}
+
+			keys, _ := arg.Args()
+			d.optional = []dictKey{}
+
+			for _, key := range keys {
+				k, err := c.compileKey(key)
+
+				if err != nil {
+					return nil, err
+				}
+
+				d.optional = append(d.optional, k)
+			}
+
+		case "rest":
+			if d.rest != nil {
+				return nil, fmt.Errorf("%s unexpected (rest ...)", arg.Pos)
+			}
+
+			if n, _ := arg.Len(); n != 2 {
+				return nil, fmt.Errorf("%s expected (rest type)", arg.Pos)
+			}
+
+			elem, _ := arg.Index(1)
+			t, err := c.compileType(elem)
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.rest = t
+
+		default:
+			return nil, fmt.Errorf("%s expected (key k type), (optional ...) or (rest type)", arg.Pos)
+		}
+	}
+
+	return d, nil
+}
+
+func (c *compiler) compileKey(v macro.Value) (dictKey, error) {
+	if h, _ := v.Head(); h != "key" {
+		return dictKey{}, fmt.Errorf("%s expected (key k type)", v.Pos)
+	}
+
+	if n, _ := v.Len(); n != 3 {
+		return dictKey{}, fmt.Errorf("%s expected (key k type)", v.Pos)
+	}
+
+	key, _ := v.Index(1)
+
+	switch key.Datum.(type) {
+	case macro.Symbol, string, int, float64:
+
+	default:
+		return dictKey{}, fmt.Errorf("%s expected symbol, string or number as dict key, got %s", key.Pos, macro.Describe(key.Datum))
+	}
+
+	val, _ := v.Index(2)
+	t, err := c.compileType(val)
+
+	if err != nil {
+		return dictKey{}, err
+	}
+
+	return dictKey{key.Datum, t}, nil
+}
+
+func (k *kind) accepts(v macro.Value) bool {
+	return k.test(v.Datum)
+}
+
+func (k *kind) validate(v macro.Value, errs *[]error) {
+	if !k.test(v.Datum) {
+		*errs = append(*errs, errorExpected(v, k))
+	}
+}
+
+func (k *kind) String() string {
+	return k.name
+}
+
+func (r *ref) accepts(v macro.Value) bool {
+	return r.schema.types[r.name].accepts(v)
+}
+
+func (r *ref) validate(v macro.Value, errs *[]error) {
+	r.schema.types[r.name].validate(v, errs)
+}
+
+func (r *ref) String() string {
+	return r.schema.types[r.name].String()
+}
+
+func (e *enum) accepts(v macro.Value) bool {
+	for _, datum := range e.data {
+		if macro.Equal(datum, v.Datum) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *enum) validate(v macro.Value, errs *[]error) {
+	if !e.accepts(v) {
+		*errs = append(*errs, errorExpected(v, e))
+	}
+}
+
+func (e *enum) String() string {
+	names := make([]string, len(e.data))
+
+	for i, datum := range e.data {
+		names[i] = fmt.Sprint(datum)
+	}
+
+	return "one of " + strings.Join(names, ", ")
+}
+
+func (f *form) accepts(v macro.Value) bool {
+	head, err := v.Head()
+	return err == nil && head == f.head
+}
+
+func (f *form) validate(v macro.Value, errs *[]error) {
+	if !f.accepts(v) {
+		*errs = append(*errs, errorExpected(v, f))
+		return
+	}
+
+	args, _ := v.Args()
+
+	for i, t := range f.required {
+		if i >= len(args) {
+			*errs = append(*errs, fmt.Errorf("%s missing %s in %s", v.Pos, t, f))
+			return
+		}
+
+		t.validate(args[i], errs)
+	}
+
+	args = args[len(f.required):]
+
+	for i, t := range f.optional {
+		if i >= len(args) {
+			return
+		}
+
+		t.validate(args[i], errs)
+	}
+
+	args = args[min(len(f.optional), len(args)):]
+
+	for _, arg := range args {
+		if f.rest == nil {
+			*errs = append(*errs, fmt.Errorf("%s unexpected %s in %s", arg.Pos, macro.Describe(arg.Datum), f))
+			return
+		}
+
+		f.rest.validate(arg, errs)
+	}
+}
+
+func (f *form) String() string {
+	return fmt.Sprintf("(%s ...)", f.head)
+}
+
+func (l *listOf) accepts(v macro.Value) bool {
+	return v.IsList()
+}
+
+func (l *listOf) validate(v macro.Value, errs *[]error) {
+	items, err := v.List()
+
+	if err != nil {
+		*errs = append(*errs, errorExpected(v, l))
+		return
+	}
+
+	if head, err := v.Head(); err == nil && head == "list" {
+		items = items[1:]
+	}
+
+	for _, item := range items {
+		l.elem.validate(item, errs)
+	}
+}
+
+func (l *listOf) String() string {
+	return "list"
+}
+
+func (s *setOf) accepts(v macro.Value) bool {
+	head, err := v.Head()
+	return err == nil && head == "set"
+}
+
+func (s *setOf) validate(v macro.Value, errs *[]error) {
+	if !s.accepts(v) {
+		*errs = append(*errs, errorExpected(v, s))
+		return
+	}
+
+	items, _ := v.Args()
+
+	for _, item := range items {
+		s.elem.validate(item, errs)
+	}
+}
+
+func (s *setOf) String() string {
+	return "set"
+}
+
+func (d *dict) accepts(v macro.Value) bool {
+	switch v.Datum.(type) {
+	case *macro.Dict[any], map[any]any:
+		return true
+	}
+
+	head, err := v.Head()
+	return err == nil && head == "dict"
+}
+
+func (d *dict) validate(v macro.Value, errs *[]error) {
+	if !d.accepts(v) {
+		*errs = append(*errs, errorExpected(v, d))
+		return
+	}
+
+	entries, err := v.Dict()
+
+	if err != nil {
+		*errs = append(*errs, err)
+		return
+	}
+
+	known := map[any]bool{}
+
+	for _, k := range d.required {
+		known[k.key] = true
+
+		if val, ok := entries.Get(k.key); ok {
+			k.typ.validate(val, errs)
+		} else {
+			*errs = append(*errs, fmt.Errorf("%s missing key %v in dict", v.Pos, k.key))
+		}
+	}
+
+	for _, k := range d.optional {
+		known[k.key] = true
+
+		if val, ok := entries.Get(k.key); ok {
+			k.typ.validate(val, errs)
+		}
+	}
+
+	for key, val := range entries.All() {
+		if known[key] {
+			continue
+		}
+
+		if d.rest == nil {
+			*errs = append(*errs, fmt.Errorf("%s unexpected key %v in dict", val.Pos, key))
+			continue
+		}
+
+		d.rest.validate(val, errs)
+	}
+}
+
+func (d *dict) String() string {
+	return "dict"
+}
+
+func (o *or) accepts(v macro.Value) bool {
+	for _, alt := range o.alts {
+		if alt.accepts(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate reports the errors of the only alternative that accepts the shape
+// of v, so that a malformed form is diagnosed in detail, and otherwise that v
+// matches none of the alternatives.
+func (o *or) validate(v macro.Value, errs *[]error) {
+	var accepted [][]error
+
+	for _, alt := range o.alts {
+		var altErrs []error
+		alt.validate(v, &altErrs)
+
+		if len(altErrs) == 0 {
+			return
+		}
+
+		if alt.accepts(v) {
+			accepted = append(accepted, altErrs)
+		}
+	}
+
+	if len(accepted) == 1 {
+		*errs = append(*errs, accepted[0]...)
+		return
+	}
+
+	*errs = append(*errs, errorExpected(v, o))
+}
+
+func (o *or) String() string {
+	names := make([]string, len(o.alts))
+
+	for i, alt := range o.alts {
+		names[i] = alt.String()
+	}
+
+	return strings.Join(names, " or ")
+}
+
+func errorExpected(v macro.Value, t typ) error {
+	return fmt.Errorf("%s expected %s, got %s", v.Pos, t, macro.Describe(v.Datum))
+}
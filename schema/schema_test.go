@@ -0,0 +1,148 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package schema
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mowen132/macro"
+)
+
+func validate(t *testing.T, s *Schema, src string) error {
+	t.Helper()
+	v, err := macro.UnmarshalValue([]byte(src))
+
+	if err != nil {
+		t.Fatalf("UnmarshalValue(%q): %v", src, err)
+	}
+
+	return Validate(v, s)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"(define x int)", "missing root"},
+		{"(root y)", "[1:7] undefined type y"},
+		{"(root int) (define int string)", "[1:20] cannot redefine int"},
+		{"(root x) (define x int) (define x string)", "[1:33] duplicate definition of x"},
+		{"(root a) (define a a)", "[1:20] type a refers to itself"},
+		{"(root x) (define x (or int y)) (define y (or string x))", "[1:53] type x refers to itself"},
+		{"(root (dict (key (a b) int)))", "[1:18] expected symbol, string or number as dict key, got (a ...)"},
+		{"(root (dict (key [1] int)))", "expected symbol, string or number as dict key"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.src)
+
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Parse(%q) = %v, want error containing %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestCompileRecursive(t *testing.T) {
+	for _, src := range []string{
+		"(root (or a int)) (define a (list-of a))",
+		"(root t) (define t (or int (form node t t)))",
+		"(root a) (define a b) (define b int)",
+	} {
+		if _, err := Parse(src); err != nil {
+			t.Errorf("Parse(%q): %v", src, err)
+		}
+	}
+}
+
+func TestValidateDict(t *testing.T) {
+	s := MustParse(`(root (dict (key port int) (key "host" string) (optional (key 1 symbol))))`)
+
+	if err := validate(t, s, `{port 80 "host" "a" 1 x}`); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	err := validate(t, s, `{port "80" other 1}`)
+
+	for _, want := range []string{
+		`[1:7] expected int, got string`,
+		`[1:1] missing key host in dict`,
+		`[1:18] unexpected key other in dict`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate = %v, want error containing %q", err, want)
+		}
+	}
+}
+
+func TestValidateOr(t *testing.T) {
+	s := MustParse(`
+		(root (or int (form add int int) (form neg int)))
+	`)
+
+	if err := validate(t, s, "(add 1 2)"); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	// Only (add ...) accepts the shape, so its errors are reported.
+	if err := validate(t, s, `(add 1 "2")`); err == nil || err.Error() != "[1:8] expected int, got string" {
+		t.Errorf("Validate = %v, want the error of (add ...)", err)
+	}
+
+	if err := validate(t, s, `"x"`); err == nil || err.Error() != "[1:1] expected int or (add ...) or (neg ...), got string" {
+		t.Errorf("Validate = %v, want no alternative matched", err)
+	}
+}
+
+func TestValidateDeepOr(t *testing.T) {
+	s := MustParse("(root e) (define e (or int (form neg e)))")
+	src := strings.Repeat("(neg ", 200) + `"x"` + strings.Repeat(")", 200)
+	start := time.Now()
+	err := validate(t, s, src)
+
+	if err == nil || !strings.Contains(err.Error(), "expected int or (neg ...), got string") {
+		t.Errorf("Validate = %v, want error at the innermost datum", err)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Validate took %v", d)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	s := MustParse(`
+		(root (or server tags))
+		(define server (form server string (optional int) (rest (enum debug info))))
+		(define tags (form tags (list-of symbol) (set-of int)))
+	`)
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`(server "a" 1 debug info)`, ""},
+		{`(tags [a b] #{1 2})`, ""},
+		{`(server)`, "[1:1] missing string in (server ...)"},
+		{`(server "a" 1 trace)`, "[1:15] expected one of debug, info, got symbol"},
+		{`(server "a" x)`, "[1:13] expected int, got symbol"},
+		{`(tags [a 1] #{1})`, "[1:10] expected symbol, got int"},
+		{`(tags [] #{x})`, "[1:12] expected int, got symbol"},
+		{`(tags [] [1])`, "[1:10] expected set, got (list ...)"},
+		{`(other)`, "[1:1] expected (server ...) or (tags ...), got (other ...)"},
+	}
+
+	for _, test := range tests {
+		err := validate(t, s, test.src)
+
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("Validate(%s): %v", test.src, err)
+			}
+		} else if err == nil || err.Error() != test.want {
+			t.Errorf("Validate(%s) = %v, want %q", test.src, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+// SourceMap maps spans of encoded output back to the spans of source that
+// the encoded values were decoded, or derived, from.
+type SourceMap struct {
+	Mappings []Mapping
+}
+
+// Mapping relates the output span Pos to End to the source span SourcePos to
+// SourceEnd. Mappings are ordered by output position, with a list before the
+// elements inside it.
+type Mapping struct {
+	Pos       Position
+	End       Position
+	SourcePos Position
+	SourceEnd Position
+}
+
+// Lookup returns the innermost mapping whose output span contains pos.
+func (m *SourceMap) Lookup(pos Position) (Mapping, bool) {
+	for i := len(m.Mappings) - 1; i >= 0; i-- {
+		mapping := m.Mappings[i]
+
+		if mapping.Pos.Offset <= pos.Offset && pos.Offset < mapping.End.Offset {
+			return mapping, true
+		}
+	}
+
+	return Mapping{}, false
+}
@@ -3,4 +3,47 @@
 
 package macro
 
+import (
+	"unicode"
+)
+
 type Symbol string
+
+// DefaultSymbolStart reports whether c may begin a symbol under the default
+// scanner rules. Signs, dots, digits and '#' have syntax of their own and are
+// handled separately.
+func DefaultSymbolStart(c rune) bool {
+	switch c {
+	case '!', '$', '%', '&', '*', '/', ':', '<', '=', '>',
+		'?', '@', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H',
+		'I', 'J', 'K', 'L', 'M', 'N', 'O', 'P', 'Q', 'R',
+		'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '\\', '^',
+		'_', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i',
+		'j', 'k', 'l', 'm', 'n', 'o', 'p', 'q', 'r', 's',
+		't', 'u', 'v', 'w', 'x', 'y', 'z', '|', '~':
+
+		return true
+	}
+
+	return unicode.IsLetter(c)
+}
+
+// DefaultSymbolChar reports whether c may continue a symbol under the default
+// scanner rules.
+func DefaultSymbolChar(c rune) bool {
+	switch c {
+	case '!', '#', '$', '%', '&', '*', '+', '-', '.', '/',
+		'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+		':', '<', '=', '>', '?', '@', 'A', 'B', 'C', 'D',
+		'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N',
+		'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X',
+		'Y', 'Z', '\\', '^', '_', 'a', 'b', 'c', 'd', 'e',
+		'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+		'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y',
+		'z', '|', '~':
+
+		return true
+	}
+
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
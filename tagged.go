@@ -0,0 +1,31 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tagged is a tagged literal such as #uuid "..." whose tag is registered
+// with the Decoder without a constructor. Encoding a Tagged reproduces the
+// literal.
+type Tagged struct {
+	Tag Symbol
+	Val any
+}
+
+func decodeInst(val any) (any, error) {
+	s, ok := val.(string)
+
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %T", val)
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func encodeInst(val any) (any, error) {
+	return val.(time.Time).Format(time.RFC3339Nano), nil
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 )
 
+// Token is a lexical token spanning the source from Pos up to, but not
+// including, End.
 type Token struct {
 	Kind TokenKind
 	Val  string
 	Pos  Position
+	End  Position
 }
 
 type TokenKind int
@@ -33,6 +36,13 @@ const (
 	TokenComment
 	TokenNewline
 	TokenEnd
+
+	// Kinds added later follow the original ones, so that their values are
+	// unchanged.
+	TokenDot
+	TokenLeftSet
+	TokenTag
+	TokenMacro
 )
 
 func (t *Token) String() string {
@@ -69,6 +79,9 @@ func (t *Token) String() string {
 	case TokenRightCurly:
 		return "RCU " + prefix
 
+	case TokenLeftSet:
+		return "LSE " + prefix
+
 	case TokenQuote:
 		return "QUO " + prefix
 
@@ -78,6 +91,15 @@ func (t *Token) String() string {
 	case TokenUnquote:
 		return "UNQ " + prefix
 
+	case TokenDot:
+		return "DOT " + prefix
+
+	case TokenTag:
+		return fmt.Sprintf("TAG %s %q", prefix, t.Val)
+
+	case TokenMacro:
+		return fmt.Sprintf("MAC %s %q", prefix, t.Val)
+
 	case TokenWhitespace:
 		return fmt.Sprintf("WHI %s %q", prefix, t.Val)
 
@@ -0,0 +1,350 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Value is a decoded datum together with the span of source it was read from.
+// Values returned by Decoder.DecodeValue also carry the spans of nested list
+// elements; the accessors report shape mismatches at those positions.
+type Value struct {
+	Datum any
+	Pos   Position
+	End   Position
+	items []Value
+}
+
+// ValueOf wraps a datum that has no recorded position.
+func ValueOf(datum any) Value {
+	return Value{Datum: datum}
+}
+
+// ListOf builds a list from items, keeping their positions. The list spans
+// from the first item to the last.
+func ListOf(items ...Value) Value {
+	list := make([]any, len(items))
+
+	for i, item := range items {
+		list[i] = item.Datum
+	}
+
+	v := Value{Datum: list, items: items}
+
+	if len(items) > 0 {
+		v.Pos = items[0].Pos
+		v.End = items[len(items)-1].End
+	}
+
+	return v
+}
+
+// Derive returns a value for a datum produced from v, such as by rewriting
+// it, spanning the same source as v so that errors about the new datum point
+// at its origin.
+func (v Value) Derive(datum any) Value {
+	return Value{Datum: datum, Pos: v.Pos, End: v.End}
+}
+
+// DeriveList is like Derive for a list built from items, which keep their
+// own positions.
+func (v Value) DeriveList(items ...Value) Value {
+	list := ListOf(items...)
+	list.Pos, list.End = v.Pos, v.End
+	return list
+}
+
+func UnmarshalValue(b []byte) (Value, error) {
+	d := NewDecoderWithOptions(bytes.NewReader(b), DecoderOptions{Scanner: ScannerOptions{QuotedSymbols: true}})
+	val, err := d.DecodeValue()
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return val, err
+}
+
+func (v Value) IsList() bool {
+	_, ok := v.Datum.([]any)
+	return ok
+}
+
+func (v Value) List() ([]Value, error) {
+	list, ok := v.Datum.([]any)
+
+	if !ok {
+		return nil, v.errorExpected("list")
+	}
+
+	if len(v.items) == len(list) {
+		return v.items, nil
+	}
+
+	items := make([]Value, len(list))
+
+	for i, elem := range list {
+		items[i] = Value{Datum: elem, Pos: v.Pos, End: v.End}
+	}
+
+	return items, nil
+}
+
+func (v Value) Len() (int, error) {
+	list, ok := v.Datum.([]any)
+
+	if !ok {
+		return 0, v.errorExpected("list")
+	}
+
+	return len(list), nil
+}
+
+func (v Value) Index(i int) (Value, error) {
+	items, err := v.List()
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	if i < 0 || i >= len(items) {
+		return Value{}, fmt.Errorf("%s index %d out of range for list of length %d", v.Pos, i, len(items))
+	}
+
+	return items[i], nil
+}
+
+func (v Value) Head() (Symbol, error) {
+	items, err := v.List()
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(items) == 0 {
+		return "", fmt.Errorf("%s expected form, got empty list", v.Pos)
+	}
+
+	return items[0].AsSymbol()
+}
+
+func (v Value) Args() ([]Value, error) {
+	if _, err := v.Head(); err != nil {
+		return nil, err
+	}
+
+	items, _ := v.List()
+	return items[1:], nil
+}
+
+func (v Value) AsInt() (int, error) {
+	if n, ok := v.Datum.(int); ok {
+		return n, nil
+	}
+
+	return 0, v.errorExpected("int")
+}
+
+func (v Value) AsFloat() (float64, error) {
+	switch n := v.Datum.(type) {
+	case float64:
+		return n, nil
+
+	case int:
+		return float64(n), nil
+	}
+
+	return 0, v.errorExpected("number")
+}
+
+func (v Value) AsString() (string, error) {
+	if s, ok := v.Datum.(string); ok {
+		return s, nil
+	}
+
+	return "", v.errorExpected("string")
+}
+
+func (v Value) AsSymbol() (Symbol, error) {
+	if s, ok := v.Datum.(Symbol); ok {
+		return s, nil
+	}
+
+	return "", v.errorExpected("symbol")
+}
+
+// Dict returns the keys and values of a (dict k v ...) form, as decoded from
+// a {...} literal, in source order.
+func (v Value) Dict() (*Dict[Value], error) {
+	switch m := v.Datum.(type) {
+	case *Dict[any]:
+		dict := NewDict[Value]()
+
+		for key, val := range m.All() {
+			dict.Set(key, Value{Datum: val, Pos: v.Pos, End: v.End})
+		}
+
+		return dict, nil
+
+	case map[any]any:
+		dict := NewDict[Value]()
+
+		for _, key := range sortedKeys(m) {
+			dict.Set(key, Value{Datum: m[key], Pos: v.Pos, End: v.End})
+		}
+
+		return dict, nil
+	}
+
+	if !v.isDict() {
+		return nil, v.errorExpected("dict")
+	}
+
+	items, _ := v.List()
+	items = items[1:]
+
+	if len(items)%2 != 0 {
+		return nil, fmt.Errorf("%s missing value for key in dict", items[len(items)-1].Pos)
+	}
+
+	dict := NewDict[Value]()
+
+	for i := 0; i < len(items); i += 2 {
+		key := items[i]
+
+		if !isDictKey(key.Datum) {
+			return nil, key.errorExpected("atom as dict key")
+		}
+
+		if _, ok := dict.Get(key.Datum); ok {
+			return nil, fmt.Errorf("%s duplicate dict key %v", key.Pos, key.Datum)
+		}
+
+		dict.Set(key.Datum, items[i+1])
+	}
+
+	return dict, nil
+}
+
+// Get follows a path of int indexes and keys from v. A key selects the value
+// stored under it when v is a dict, and otherwise the first element of v that
+// is a form headed by the key. String keys also match symbols of that name.
+func (v Value) Get(path ...any) (Value, error) {
+	for _, key := range path {
+		var err error
+
+		switch k := key.(type) {
+		case int:
+			v, err = v.Index(k)
+
+		case Symbol:
+			v, err = v.get(k)
+
+		case string:
+			v, err = v.get(k)
+
+		default:
+			err = fmt.Errorf("unsupported path element type: %T", key)
+		}
+
+		if err != nil {
+			return Value{}, err
+		}
+	}
+
+	return v, nil
+}
+
+func (v Value) isDict() bool {
+	switch v.Datum.(type) {
+	case *Dict[any], map[any]any:
+		return true
+	}
+
+	head, err := v.Head()
+	return err == nil && head == "dict"
+}
+
+func (v Value) get(key any) (Value, error) {
+	if v.isDict() {
+		dict, err := v.Dict()
+
+		if err != nil {
+			return Value{}, err
+		}
+
+		if val, ok := dict.Get(key); ok {
+			return val, nil
+		}
+
+		if s, ok := key.(string); ok {
+			if val, ok := dict.Get(Symbol(s)); ok {
+				return val, nil
+			}
+		}
+
+		return Value{}, fmt.Errorf("%s missing dict key %v", v.Pos, key)
+	}
+
+	items, err := v.List()
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	name := Symbol(fmt.Sprint(key))
+
+	for _, item := range items {
+		if head, err := item.Head(); err == nil && head == name {
+			return item, nil
+		}
+	}
+
+	return Value{}, fmt.Errorf("%s missing form %s", v.Pos, name)
+}
+
+func (v Value) errorExpected(what string) error {
+	return fmt.Errorf("%s expected %s, got %s", v.Pos, what, Describe(v.Datum))
+}
+
+// Describe names the kind of datum in error messages: int, symbol, empty
+// list, (head ...) and so on.
+func Describe(datum any) string {
+	switch v := datum.(type) {
+	case int:
+		return "int"
+
+	case float64:
+		return "float"
+
+	case string:
+		return "string"
+
+	case Symbol:
+		return "symbol"
+
+	case Pair:
+		return "pair"
+
+	case Tagged:
+		return "#" + string(v.Tag)
+
+	case []any:
+		if len(v) == 0 {
+			return "empty list"
+		}
+
+		if head, ok := v[0].(Symbol); ok {
+			return fmt.Sprintf("(%s ...)", head)
+		}
+
+		return "list"
+
+	default:
+		return fmt.Sprintf("%T", datum)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SkipList can be returned by Visitor.StartList to skip the rest of the list,
+// or by Visitor.Quote to skip the quoted datum, without further callbacks. It
+// may be wrapped.
+var SkipList = errors.New("skip list")
+
+// Visitor receives the structure of the input as Walk scans it. Lists are
+// reported with the kind of their opening token, and prefixes such as quotes,
+// tags and reader macros are reported to Quote before the datum they apply to.
+type Visitor interface {
+	StartList(kind TokenKind, pos Position) error
+	EndList(pos Position) error
+	Atom(tok *Token) error
+	Quote(tok *Token) error
+}
+
+// DotVisitor is implemented by visitors that want the dot of a dotted pair
+// or improper list, which Walk otherwise skips.
+type DotVisitor interface {
+	Dot(pos Position) error
+}
+
+// Walk scans every datum from s and reports it to v without building values.
+func Walk(s *Scanner, v Visitor) error {
+	var stack []TokenKind
+
+	for {
+		tok, err := scanSignificant(s)
+
+		if err != nil {
+			return err
+		}
+
+		switch tok.Kind {
+		case TokenLeftParenthesis, TokenLeftSquare, TokenLeftCurly, TokenLeftSet:
+			err = v.StartList(tok.Kind, tok.Pos)
+
+			if errors.Is(err, SkipList) {
+				err = skipList(s, tok.Kind)
+			} else if err == nil {
+				stack = append(stack, tok.Kind)
+			}
+
+		case TokenRightParenthesis, TokenRightSquare, TokenRightCurly:
+			if len(stack) == 0 || closingDelimiter(stack[len(stack)-1]) != tok.Kind {
+				return fmt.Errorf("%s unexpected %s", tok.Pos, delimiter(tok.Kind))
+			}
+
+			stack = stack[:len(stack)-1]
+			err = v.EndList(tok.Pos)
+
+		case TokenQuote, TokenQuasiquote, TokenUnquote, TokenTag, TokenMacro:
+			err = v.Quote(tok)
+
+			if errors.Is(err, SkipList) {
+				err = skipDatum(s)
+			}
+
+		case TokenDot:
+			if dv, ok := v.(DotVisitor); ok {
+				err = dv.Dot(tok.Pos)
+			}
+
+		case TokenEnd:
+			if len(stack) > 0 {
+				return fmt.Errorf("%s unexpected eof", tok.Pos)
+			}
+
+			return nil
+
+		default:
+			err = v.Atom(tok)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func scanSignificant(s *Scanner) (*Token, error) {
+	for {
+		tok, err := s.Scan()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Kind {
+		case TokenWhitespace, TokenComment, TokenNewline:
+			continue
+		}
+
+		return tok, nil
+	}
+}
+
+func skipList(s *Scanner, kind TokenKind) error {
+	stack := []TokenKind{kind}
+
+	for len(stack) > 0 {
+		tok, err := scanSignificant(s)
+
+		if err != nil {
+			return err
+		}
+
+		switch tok.Kind {
+		case TokenLeftParenthesis, TokenLeftSquare, TokenLeftCurly, TokenLeftSet:
+			stack = append(stack, tok.Kind)
+
+		case TokenRightParenthesis, TokenRightSquare, TokenRightCurly:
+			if closingDelimiter(stack[len(stack)-1]) != tok.Kind {
+				return fmt.Errorf("%s unexpected %s", tok.Pos, delimiter(tok.Kind))
+			}
+
+			stack = stack[:len(stack)-1]
+
+		case TokenEnd:
+			return fmt.Errorf("%s unexpected eof", tok.Pos)
+		}
+	}
+
+	return nil
+}
+
+func skipDatum(s *Scanner) error {
+	for {
+		tok, err := scanSignificant(s)
+
+		if err != nil {
+			return err
+		}
+
+		switch tok.Kind {
+		case TokenLeftParenthesis, TokenLeftSquare, TokenLeftCurly, TokenLeftSet:
+			return skipList(s, tok.Kind)
+
+		case TokenQuote, TokenQuasiquote, TokenUnquote, TokenTag, TokenMacro:
+			continue
+
+		case TokenRightParenthesis, TokenRightSquare, TokenRightCurly:
+			return fmt.Errorf("%s unexpected %s", tok.Pos, delimiter(tok.Kind))
+
+		case TokenDot:
+			return fmt.Errorf("%s unexpected .", tok.Pos)
+
+		case TokenEnd:
+			return fmt.Errorf("%s unexpected eof", tok.Pos)
+		}
+
+		return nil
+	}
+}
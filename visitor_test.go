@@ -0,0 +1,82 @@
+// Copyright (c) 2025 Mark Owen
+// Licensed under the MIT License. See LICENSE file in the project root for details.
+
+package macro
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	events []string
+	skip   string
+}
+
+func (r *recorder) StartList(kind TokenKind, pos Position) error {
+	r.events = append(r.events, "(")
+
+	if r.skip == "list" {
+		return fmt.Errorf("skipping: %w", SkipList)
+	}
+
+	return nil
+}
+
+func (r *recorder) EndList(pos Position) error {
+	r.events = append(r.events, ")")
+	return nil
+}
+
+func (r *recorder) Atom(tok *Token) error {
+	r.events = append(r.events, tok.Val)
+	return nil
+}
+
+func (r *recorder) Quote(tok *Token) error {
+	r.events = append(r.events, "'")
+
+	if r.skip == "quote" {
+		return fmt.Errorf("skipping: %w", SkipList)
+	}
+
+	return nil
+}
+
+func (r *recorder) result() []string {
+	return r.events
+}
+
+type dotRecorder struct {
+	recorder
+}
+
+func (r *dotRecorder) Dot(pos Position) error {
+	r.events = append(r.events, "dot")
+	return nil
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		src  string
+		v    interface{ result() []string }
+		want string
+	}{
+		{"(a . b) c", &recorder{}, "( a b ) c"},
+		{"(a . b) c", &dotRecorder{}, "( a dot b ) c"},
+		{"(a (b)) c", &recorder{skip: "list"}, "( c"},
+		{"'(a b) c", &recorder{skip: "quote"}, "' c"},
+	}
+
+	for _, test := range tests {
+		if err := Walk(NewScanner(strings.NewReader(test.src)), test.v.(Visitor)); err != nil {
+			t.Errorf("Walk(%q): %v", test.src, err)
+			continue
+		}
+
+		if got := strings.Join(test.v.result(), " "); got != test.want {
+			t.Errorf("Walk(%q) visited %s, want %s", test.src, got, test.want)
+		}
+	}
+}